@@ -2,19 +2,27 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"encoding/xml"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"math"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"os"
-	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -24,7 +32,55 @@ type settings struct {
 	Config            string
 	PlaylistItems     string
 	PushoverUserToken string
-	PodcastDownload   []YouTubeDownload `xml:"PodcastDownload"`
+	// FailureAlertWindow is how long a channel that keeps failing stays quiet
+	// before alerting again, as a Go duration such as "12h".
+	FailureAlertWindow string
+	// TimeZone is an IANA zone name such as "Australia/Melbourne" used for
+	// QuietHours; empty means the container's local time.
+	TimeZone   string
+	QuietHours []QuietHours `xml:"QuietHours"`
+	// RetryAttempts is how many times a rate limited or network failure is
+	// tried, 3 by default. RetryBackoff is the wait before the first retry,
+	// doubling for each after it, and RetryBudget the most a run waits in
+	// total; Go durations, 30s and 10m by default.
+	RetryAttempts string
+	RetryBackoff  string
+	RetryBudget   string
+	// VideoTimeout is the longest a single yt-dlp call, such as downloading
+	// one video, may take before it is killed and left for the next run, 2h
+	// by default. RunTimeout bounds a whole run and is unlimited by default.
+	// Both are Go durations; 0 means no limit.
+	VideoTimeout string
+	RunTimeout   string
+	// ChannelWorkers is how many channels are processed at once, 1 by
+	// default. MaxDownloads caps the yt-dlp downloads running at once across
+	// them and defaults to ChannelWorkers.
+	ChannelWorkers string
+	MaxDownloads   string
+	// LimitRate, DownloadWindow, BacklogWindow, Cookies, Proxy,
+	// ExtractorArgs and ExtraArgs apply to every channel that sets neither
+	// its own nor a Default; see ChannelDefaults.
+	LimitRate      string
+	DownloadWindow string
+	BacklogWindow  string
+	Cookies        string
+	Proxy          string
+	ExtractorArgs  string
+	ExtraArgs      string
+	// LogLevel is debug, info, warn or error; LogFormat is text or json.
+	LogLevel  string
+	LogFormat string
+	// FileMode and FolderMode are the octal permissions of the archive files
+	// and folders the tool creates, 0644 and 0755 by default. PUID and PGID
+	// own them when set, falling back to the PUID and PGID environment
+	// variables of linuxserver.io containers.
+	FileMode   string
+	FolderMode string
+	PUID       string
+	PGID       string
+	// Defaults apply to every PodcastDownload that does not set its own
+	Defaults        ChannelDefaults   `xml:"Defaults"`
+	PodcastDownload []YouTubeDownload `xml:"PodcastDownload"`
 }
 
 type Entry struct {
@@ -36,19 +92,6 @@ type Entry struct {
 	Content   string
 }
 
-type Validate struct {
-	MediaFolder                     bool
-	Config                          bool
-	PodcastDownload_Name            bool
-	PodcastDownload_ChannelID       bool
-	PodcastDownload_DownloadArchive bool
-	PodcastDownload_FileFormat      bool
-	PodcastDownload_FileQuality     bool
-	PlaylistItems                   bool
-	PushoverUserToken               bool
-	PodcastDownload_YouTubeURL      bool
-}
-
 type YouTubeDownload struct {
 	Name             string `xml:"Name"`
 	ChannelID        string `xml:"ChannelID"`
@@ -59,6 +102,37 @@ type YouTubeDownload struct {
 	YouTubeURL       string `xml:"YouTubeURL"`
 	PushoverAppToken string `xml:"PushoverAppToken"`
 	// PushoverAppToken
+	PushoverPriority string `xml:"PushoverPriority"`
+	PushoverSound    string `xml:"PushoverSound"`
+	// Overrides for the global and Defaults settings of the same name
+	PlaylistItems     string `xml:"PlaylistItems"`
+	MediaFolder       string `xml:"MediaFolder"`
+	Retention         string `xml:"Retention"`
+	PushoverUserToken string `xml:"PushoverUserToken"`
+	LimitRate         string `xml:"LimitRate"`
+	DownloadWindow    string `xml:"DownloadWindow"`
+	BacklogWindow     string `xml:"BacklogWindow"`
+	Cookies           string `xml:"Cookies"`
+	Proxy             string `xml:"Proxy"`
+	ExtractorArgs     string `xml:"ExtractorArgs"`
+	ExtraArgs         string `xml:"ExtraArgs"`
+	MinDuration       string `xml:"MinDuration"`
+	MaxDuration       string `xml:"MaxDuration"`
+	TitleInclude      string `xml:"TitleInclude"`
+	TitleExclude      string `xml:"TitleExclude"`
+	SkipShorts        string `xml:"SkipShorts"`
+	SkipLive          string `xml:"SkipLive"`
+	SkipPremieres     string `xml:"SkipPremieres"`
+	UploadedAfter     string `xml:"UploadedAfter"`
+	UploadedBefore    string `xml:"UploadedBefore"`
+	Backfill          string `xml:"Backfill"`
+	BackfillBatch     string `xml:"BackfillBatch"`
+	// Disabled channels are kept in the settings but not run
+	Disabled bool `xml:"Disabled"`
+
+	// The channel ID YouTubeURL resolved to, or why it could not be
+	resolvedID string
+	resolveErr error
 }
 
 type JsonData struct {
@@ -78,41 +152,46 @@ type JsonChannelData struct {
 	description string
 }
 
-func isOlderThan(t time.Time) bool {
-	return time.Now().Sub(t) > 168*time.Hour
+func isOlderThan(t time.Time, retention time.Duration) bool {
+	return time.Now().Sub(t) > retention
 }
 
-func DeleteOldFiles(dir string) {
+// DeleteOldFiles removes episodes older than retention; zero keeps them all.
+// An episode's age is that of its .description, and everything of the
+// video goes with it: the renamed media and artwork as well as the metadata.
+func DeleteOldFiles(logger *slog.Logger, dir string, retention time.Duration) {
+	logger = logger.With("phase", "cleanup")
+	if retention == 0 {
+		return
+	}
 	descfiles, descerr := WalkMatch(dir, "*.description")
 
 	if descerr != nil {
-		log.Printf("------------------      START List description Files ERROR")
-		log.Fatal(descerr)
-		log.Printf("------------------      END List description Files ERROR")
+		logger.Error("listing description files failed", "dir", dir, "error", descerr)
+		return
 	}
 
 	for _, fname := range descfiles {
-		arrfname_noext := strings.Split(fname, ".")
-		fname_noext := arrfname_noext[0]
-
-		log.Printf("fname:" + fname)
-		log.Printf("fname_noext:" + fname_noext)
+		logger.Debug("checking age", "file", fname)
 
 		fname_file, fname_fileerr := os.Stat(fname)
 
 		if fname_fileerr != nil {
-			log.Printf("------------------      START List fname_fileerr ERROR")
-			log.Fatal(fname_fileerr)
-			log.Printf("------------------      END List fname_fileerr ERROR")
+			logger.Error("stat failed", "file", fname, "error", fname_fileerr)
+			continue
+		}
+		if isOlderThan(fname_file.ModTime(), retention) == false {
+			continue
 		}
 
-		if isOlderThan(fname_file.ModTime()) {
-			log.Printf("DELETE FILE: " + fname_noext + ".description")
-			os.Remove(fname_noext + ".description")
-			log.Printf("DELETE FILE: " + fname_noext + ".mp4")
-			os.Remove(fname_noext + ".mp4")
-			log.Printf("DELETE FILE: " + fname_noext + ".info.json")
-			os.Remove(fname_noext + ".info.json")
+		folder := filepath.Dir(fname)
+		id := strings.TrimSuffix(filepath.Base(fname), ".description")
+		for _, pattern := range []string{id + ".*", "s01e* - " + id + ".*"} {
+			matches, _ := filepath.Glob(filepath.Join(folder, pattern))
+			for _, match := range matches {
+				logger.Info("deleting old file", "file", match)
+				os.Remove(match)
+			}
 		}
 	}
 }
@@ -146,27 +225,46 @@ func handleJSONObject(object interface{}, key, indentation string) {
 	}
 }
 
-func IsValidURL(fp string) bool {
-	log.Printf("URL Check: " + fp)
+// artworkClient also fetches file:// URLs, which FakeDownloader uses for
+// fixture artwork.
+var artworkClient = &http.Client{Transport: newArtworkTransport()}
+
+// PushoverEndpoint is where PushoverClient posts notifications. When it is
+// empty notifications are only logged, as in --fake-downloader runs without
+// --pushover-url.
+var (
+	PushoverEndpoint = "https://api.pushover.net/1/messages.json"
+	PushoverClient   = http.DefaultClient
+)
+
+// ThumbnailHost serves the maxresdefault artwork preferred over the
+// thumbnail in the .info.json; empty uses the .info.json one.
+var ThumbnailHost = "https://i.ytimg.com"
+
+func newArtworkTransport() http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.RegisterProtocol("file", http.NewFileTransport(http.Dir("/")))
+	return transport
+}
+
+func IsValidURL(ctx context.Context, logger *slog.Logger, fp string) bool {
+	ctx, cancel := context.WithTimeout(ctx, ArtworkTimeout)
+	defer cancel()
 
-	resp, err := http.Get(fp)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fp, nil)
 	if err != nil {
-		// print(err.Error())
-		log.Printf("IsValidURL Status: " + resp.Status)
-		// log.Printf("IsValidURL Error: " + err.Error())
+		logger.Debug("URL check failed", "url", fp, "error", err)
 		return false
-	} else {
-		if strings.Contains(resp.Status, "200 OK") {
-			// print(string(resp.StatusCode) + resp.Status)
-			log.Printf("URL Status: " + resp.Status)
-			return true
-		} else {
-			// print(err.Error())
-			log.Printf("IsValidURL Status: " + resp.Status)
-			return false
-		}
-
 	}
+	resp, err := artworkClient.Do(req)
+	if err != nil {
+		logger.Debug("URL check failed", "url", fp, "error", err)
+		return false
+	}
+	defer resp.Body.Close()
+
+	logger.Debug("URL checked", "url", fp, "status", resp.Status)
+	return resp.StatusCode == http.StatusOK
 }
 
 func createKeyValuePairs(m map[string]string) string {
@@ -204,10 +302,16 @@ func WalkMatch(root, pattern string) ([]string, error) {
 	return matches, nil
 }
 
-func DownloadFile(filepath string, url string) error {
+func DownloadFile(ctx context.Context, filepath string, url string) error {
+	ctx, cancel := context.WithTimeout(ctx, ArtworkTimeout)
+	defer cancel()
 
 	// Get the data
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := artworkClient.Do(req)
 	if err != nil {
 		return err
 	}
@@ -225,83 +329,103 @@ func DownloadFile(filepath string, url string) error {
 	return err
 }
 
-func NotifyPushover(Config string, AppToken string, UserToken string, nTitle string, nBody string, pThumbnail string, nURL string) {
+// attachmentHeader describes the attachment part of a Pushover request. The
+// picture's own type is sent, as curl did, rather than octet-stream.
+func attachmentHeader(fname string, content []byte) textproto.MIMEHeader {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="attachment"; filename="%s"`, quoteEscaper.Replace(fname)))
+	header.Set("Content-Type", http.DetectContentType(content))
+	return header
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func NotifyPushover(ctx context.Context, n Notification) error {
 	// NotifyPushover("apb75jkyb1iegxzp4styr5tgidq3fg","RSS Podcast Downloaded (" + pName + ")","<html><body>" + ytvideo_title + "<br /><br />--------------------------------------------<br /><br />" + ytvideo_description + "</body></html>",ytvideo_thumbnail)
 
-	log.Println("-----		")
-	log.Println("-----		START NotifyPushover")
-	log.Println("-----		")
+	logger := slog.With("channel", n.Channel, "phase", "notify")
 
 	// ~~~~~~~~~~~~~~ Print Data ~~~~~~~~~~~~~~~~
 
-	log.Printf("------------------      START Print Data")
-	log.Printf("Config: " + Config)
-	log.Printf("AppToken: " + AppToken)
-	log.Printf("UserToken: " + UserToken)
-	log.Printf("nTitle: " + nTitle)
-	log.Printf("nBody: " + nBody)
-	log.Printf("pThumbnail: " + pThumbnail)
-	log.Printf("nURL: " + nURL)
-	log.Printf("------------------      END Print Data")
+	logger.Debug("sending Pushover notification", "app_token", n.AppToken, "user_token", n.UserToken, "title", n.Title, "body", n.Body, "attachment", n.Attachment, "url", n.URL, "priority", n.Priority, "sound", n.Sound)
 
-	// ~~~~~~~~~~ Download Thumbnail ~~~~~~~~~~~~
+	// ~~~~~~~~~~~~~~ HTTP Post ~~~~~~~~~~~~~~~~~
 
-	savename := ""
-	if strings.HasSuffix(pThumbnail, ".jpg") {
-		savename = "maxresdefault.jpg"
+	fields := [][2]string{{"token", n.AppToken}, {"user", n.UserToken}, {"title", n.Title}, {"message", n.Body}, {"html", "1"}}
+	if n.Priority != "" {
+		fields = append(fields, [2]string{"priority", n.Priority})
+		if n.Priority == "2" {
+			// Emergency priority repeats until acknowledged and needs both
+			fields = append(fields, [2]string{"retry", "300"}, [2]string{"expire", "3600"})
+		}
+	}
+	if n.Sound != "" {
+		fields = append(fields, [2]string{"sound", n.Sound})
 	}
 
-	if strings.HasSuffix(pThumbnail, ".webp") {
-		savename = "maxresdefault.webp"
+	body := new(bytes.Buffer)
+	form := multipart.NewWriter(body)
+	for _, field := range fields {
+		form.WriteField(field[0], field[1])
+	}
+	if n.Attachment != "" {
+		// Still worth sending the notification without the picture
+		if content, fname, err := PushoverAttachment(n.Attachment); err != nil {
+			logger.Warn("thumbnail not attached", "error", err)
+		} else if part, err := form.CreatePart(attachmentHeader(fname, content)); err == nil {
+			part.Write(content)
+		}
 	}
+	form.Close()
 
-	if strings.HasSuffix(pThumbnail, ".jpg") == false && strings.HasSuffix(pThumbnail, ".webp") == false {
-		savename = "maxresdefault.jpg"
+	if PushoverEndpoint == "" {
+		logger.Info("notification not sent, no Pushover endpoint", "title", n.Title)
+		return nil
 	}
 
-	err := DownloadFile(Config+savename, pThumbnail)
+	ctx, cancel := context.WithTimeout(ctx, NotifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, PushoverEndpoint, body)
 	if err != nil {
-		// panic(err)
-		log.Printf("------------------      START DownloadFile ERROR")
-		log.Fatal(err.Error())
-		log.Printf("------------------      END DownloadFile ERROR")
+		return err
 	}
-	fmt.Println("Downloaded: " + pThumbnail)
-
-	// ~~~~~~~~~~~~~~ HTTP Post ~~~~~~~~~~~~~~~~~
-
-	out := exec.Command("curl", "-s", "--form-string", "token="+AppToken, "--form-string", "user="+UserToken, "--form-string", "title="+nTitle, "--form-string", "message="+nBody, "--form-string", "html=1", "-F", "attachment=@"+Config+savename, "https://api.pushover.net/1/messages.json")
-	out.Stdout = os.Stdout
-	out.Stderr = os.Stderr
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	resp, err := PushoverClient.Do(req)
+	if err != nil {
+		logger.Error("Pushover request failed", "error", err)
+		return err
+	}
+	defer resp.Body.Close()
 
-	if err := out.Run(); err != nil {
-		log.Printf("------------------      START NotifyPushover ERROR")
-		log.Fatal(err.Error())
-		log.Printf("------------------      END NotifyPushover ERROR")
+	respBody, _ := io.ReadAll(resp.Body)
+	logger.Debug("Pushover response", "status", resp.Status, "response", strings.TrimSpace(string(respBody)))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("pushover returned %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
 	}
 
-	log.Println("-----		END NotifyPushover")
+	logger.Info("notification sent", "title", n.Title)
+	return nil
+}
+
+// ChannelRun is what a channel's run is handed besides its own settings.
+type ChannelRun struct {
+	Config        string
+	Filter        Filter
+	Backfill      Backfill
+	Notifier      *Notifier
+	Retry         *RetryPolicy
+	VideoTimeout  time.Duration
+	DownloadSlots Limiter
 }
 
-func Run_YTDLP(sMediaFolder string, Config string, pName string, pChannelID string, pFileFormat string, pDownloadArchive string, pFileQuality string, PlaylistItems string, pYouTubeURL string, pPushoverAppToken string, pPushoverUserToken string) {
-	log.Println("-----		")
-	log.Println("-----		Start Run_YTDLP")
-	log.Println("-----		")
+// Run_YTDLP downloads a resolved channel's new videos and turns them into
+// numbered episodes. A fetched video comes in as the channel's YouTubeURL.
+func Run_YTDLP(ctx context.Context, channel YouTubeDownload, run ChannelRun) error {
+	logger := slog.With("channel", channel.Name)
+	options := ChannelOptions(channel)
 
 	// ~~~~~~~~~~~~~~ Print Data ~~~~~~~~~~~~~~~~
-	log.Println("-----		")
-	log.Printf("sMediaFolder: " + sMediaFolder)
-	log.Printf("Config: " + Config)
-	log.Printf("pName: " + pName)
-	log.Printf("pChannelID: " + pChannelID)
-	log.Printf("pFileFormat: " + pFileFormat)
-	log.Printf("pDownloadArchive: " + pDownloadArchive)
-	log.Printf("pFileQuality: " + pFileQuality)
-	log.Printf("PlaylistItems: " + PlaylistItems)
-	log.Printf("pYouTubeURL: " + pYouTubeURL)
-	log.Printf("pPushoverAppToken: " + pPushoverAppToken)
-	log.Printf("pPushoverUserToken: " + pPushoverUserToken)
-	log.Println("-----		")
+	logger.Debug("channel settings", "phase", "start", "media_folder", channel.MediaFolder, "config", run.Config, "channel_id", channel.ChannelID, "file_format", channel.FileFormat, "download_archive", channel.DownloadArchive, "file_quality", channel.FileQuality, "playlist_items", channel.PlaylistItems, "youtube_url", channel.YouTubeURL, "pushover_app_token", channel.PushoverAppToken, "pushover_user_token", channel.PushoverUserToken, "pushover_priority", channel.PushoverPriority, "pushover_sound", channel.PushoverSound)
 
 	// =========================================================
 	// ============= Download Channel JSON Only ================
@@ -329,86 +453,274 @@ func Run_YTDLP(sMediaFolder string, Config string, pName string, pChannelID stri
 	// ============= Download Videos with yt-dlp ===============
 	// =========================================================
 
-	// dlname2 := pChannelID + "/Season_1/s01e" + channelEpisodeNumberStr + " - %(id)s.%(ext)s"
-	dlname2 := pChannelID + "/Season_1/%(id)s.%(ext)s"
+	job := DownloadJob{
+		Channel:       channel.Name,
+		URL:           channel.YouTubeURL,
+		Folder:        channel.MediaFolder + channel.ChannelID + "/Season_1/",
+		Archive:       channel.DownloadArchive,
+		PlaylistItems: channel.PlaylistItems,
+		FileFormat:    channel.FileFormat,
+		FileQuality:   channel.FileQuality,
+		LimitRate:     channel.LimitRate,
+		Options:       append(options, run.Filter.FilterArgs()...),
+		Logger:        logger.With("phase", "download"),
+	}
+	downloadWindows, _ := ParseWindows(channel.DownloadWindow)
+	backlogWindows, _ := ParseWindows(channel.BacklogWindow)
+
+	state := run.Notifier.State
+	var cursor BackfillCursor
+	if run.Backfill.Order != "" {
+		state.Lock()
+		cursor = *run.Backfill.Cursor(state, channel.ChannelID)
+		state.Unlock()
+	}
+	backfilling := run.Backfill.Order != "" && cursor.Done == false
+
+	var items []Item
+	job.Logger.Info("listing new videos")
+	listerr := run.Retry.Do(ctx, job.Logger, func() (err error) {
+		listCtx, cancel := WithTimeout(ctx, run.VideoTimeout)
+		defer cancel()
+		items, err = ActiveDownloader.ListNew(listCtx, job)
+		return err
+	})
+	if listerr != nil {
+		job.Logger.Error("listing new videos failed", "error", listerr)
+		return listerr
+	}
+	job.Logger.Info("new videos found", "count", len(items))
+
+	// ~~~~~~~~~~~~~~~~~~ Backfill ~~~~~~~~~~~~~~~~~~~
+
+	// The batch is listed without the archive and filters, so a short batch
+	// shows the walk has reached the end of the channel
+	batch := map[string]bool{}
+	listed := 0
+	if backfilling {
+		batchJob := job
+		batchJob.PlaylistItems = run.Backfill.Range(cursor.Position)
+		batchJob.Archive = ""
+		batchJob.Options = options
+
+		var entries []Item
+		listerr := run.Retry.Do(ctx, job.Logger, func() (err error) {
+			listCtx, cancel := WithTimeout(ctx, run.VideoTimeout)
+			defer cancel()
+			entries, err = ActiveDownloader.ListNew(listCtx, batchJob)
+			return err
+		})
+		if listerr != nil {
+			job.Logger.Error("listing backfill batch failed", "range", batchJob.PlaylistItems, "error", listerr)
+			return listerr
+		}
 
-	log.Println("-----		")
-	log.Println("-----		Download Videos with yt-dlp")
-	log.Println("-----		")
+		archived := readArchive(job.Archive)
+		for _, item := range items {
+			archived[item.ID] = true
+		}
+		// Playlists list the newest first; the batch downloads oldest first
+		// so its episode numbers follow upload order
+		for i := len(entries) - 1; i >= 0; i-- {
+			if archived[entries[i].ID] == false {
+				batch[entries[i].ID] = true
+				items = append(items, entries[i])
+			}
+		}
+		listed = len(entries)
+		job.Logger.Info("backfill batch listed", "order", run.Backfill.Order, "range", batchJob.PlaylistItems, "videos", listed, "to_download", len(batch))
+	}
 
-	out2 := exec.Command("yt-dlp", "-v", "-o", sMediaFolder+dlname2, "--playlist-items", PlaylistItems, "--write-info-json", "--no-write-playlist-metafiles", "--download-archive", pDownloadArchive, "--restrict-filenames", "--add-metadata", "--merge-output-format", pFileFormat, "--format", pFileQuality, "--abort-on-error", "--abort-on-unavailable-fragment", "--no-overwrites", "--continue", "--write-description", pYouTubeURL)
-	out2.Stdout = os.Stdout
-	out2.Stderr = os.Stderr
+	// ~~~~~~~~~~~~~~~ Deferred Videos ~~~~~~~~~~~~~~~~
 
-	if err := out2.Run(); err != nil {
-		log.Printf("------------------      START YT-DLP ERROR")
-		log.Fatal(err.Error())
-		log.Printf("------------------      END YT-DLP ERROR")
+	// Videos an earlier run left for later are tried again even when they
+	// are no longer within PlaylistItems. Fetching one video leaves them be.
+	if _, fetching := VideoIDFromURL(channel.YouTubeURL); fetching == false {
+		queued := map[string]bool{}
+		for _, item := range items {
+			queued[item.ID] = true
+		}
+		archived := readArchive(job.Archive)
+		var pending []Item
+
+		state.Lock()
+		for id, d := range state.DeferredVideos {
+			switch {
+			case d.ChannelID != channel.ChannelID || queued[id]:
+			case archived[id]:
+				delete(state.DeferredVideos, id)
+			default:
+				pending = append(pending, Item{ID: id, URL: watchURL(id), Uploaded: d.Uploaded})
+			}
+		}
+		state.Unlock()
 
+		sort.Slice(pending, func(i, j int) bool { return pending[i].Uploaded.Before(pending[j].Uploaded) })
+		if len(pending) > 0 {
+			job.Logger.Info("deferred videos to try again", "count", len(pending))
+		}
+		items = append(items, pending...)
+	}
+
+	// Transient failures are retried; a video that cannot be downloaded at all
+	// is recorded and skipped so it does not fail the channel on every run,
+	// and one that timed out is left for the next run to continue. Anything
+	// else, such as expired cookies or the run being stopped, stops the
+	// channel.
+	var results []DownloadResult
+	deferred := map[string]bool{}
+	deferVideo := func(item Item, reason string) {
+		deferred[item.ID] = true
+		state.Lock()
+		state.DeferredVideos[item.ID] = &DeferredVideo{Channel: channel.Name, ChannelID: channel.ChannelID, Uploaded: item.Uploaded, Reason: reason, Deferred: time.Now()}
+		state.Unlock()
+	}
+	for _, item := range items {
+		state.Lock()
+		skip, ok := state.SkippedVideos[item.ID]
+		state.Unlock()
+		if ok {
+			job.Logger.Debug("skipping video that failed before", "video_id", item.ID, "class", skip.Class, "skipped", skip.Skipped)
+			continue
+		}
+
+		// Outside its window a video is left out of the archive and recorded
+		// in state, so a later run picks it up again
+		now := time.Now().In(run.Notifier.Location)
+		if InWindows(downloadWindows, now) == false {
+			job.Logger.Info("outside the download window, leaving the video for a later run", "video_id", item.ID, "window", channel.DownloadWindow)
+			deferVideo(item, "outside the download window")
+			continue
+		}
+		if IsBacklog(item.Uploaded, now) && InWindows(backlogWindows, now) == false {
+			deferVideo(item, "outside the backlog window")
+			job.Logger.Info("outside the backlog window, leaving the video for a later run", "video_id", item.ID, "uploaded", item.Uploaded.Format(time.DateOnly), "window", channel.BacklogWindow)
+			continue
+		}
+
+		job.Logger.Info("downloading video", "video_id", item.ID)
+		var result DownloadResult
+		dlerr := run.Retry.Do(ctx, job.Logger.With("video_id", item.ID), func() (err error) {
+			if err := run.DownloadSlots.Acquire(ctx); err != nil {
+				return err
+			}
+			defer run.DownloadSlots.Release()
+
+			videoCtx, cancel := WithTimeout(ctx, run.VideoTimeout)
+			defer cancel()
+			result, err = ActiveDownloader.Download(videoCtx, job, item)
+			return err
+		})
+
+		class := FailureClassOf(dlerr)
+		if dlerr == nil || class.PerVideo() {
+			state.Lock()
+			delete(state.DeferredVideos, item.ID)
+			state.Unlock()
+		}
+		switch {
+		case dlerr == nil:
+			results = append(results, result)
+		case ctx.Err() != nil:
+			job.Logger.Warn("run stopped, leaving the video for the next run", "video_id", item.ID, "error", ctx.Err())
+			return ctx.Err()
+		case class == FailureTimeout:
+			job.Logger.Warn("download timed out, trying again next run", "video_id", item.ID, "timeout", run.VideoTimeout.String())
+			deferVideo(item, "timed out")
+		case class == FailureUpcoming:
+			job.Logger.Info("video not out yet, trying again next run", "video_id", item.ID)
+			deferVideo(item, "not out yet")
+		case class.PerVideo():
+			detail := dlerr.Error()
+			var ytErr *YTDLPError
+			if errors.As(dlerr, &ytErr) {
+				detail = ErrorLines(ytErr.Stderr)
+			}
+			state.Lock()
+			state.SkippedVideos[item.ID] = &SkippedVideo{Channel: channel.Name, Class: class, Error: detail, Skipped: time.Now()}
+			state.Unlock()
+			job.Logger.Warn("skipping video that cannot be downloaded", "video_id", item.ID, "class", class, "error", detail)
+		default:
+			job.Logger.Error("downloading video failed", "video_id", item.ID, "error", dlerr)
+			return dlerr
+		}
+	}
+
+	// The cursor only moves on once every video of the batch is done with,
+	// downloaded or skipped, so a deferred one is listed again
+	if backfilling {
+		finished := true
+		for id := range batch {
+			finished = finished && deferred[id] == false
+		}
+		state.Lock()
+		c := run.Backfill.Cursor(state, channel.ChannelID)
+		if finished {
+			c.Position += run.Backfill.Batch
+			c.Done = listed < run.Backfill.Batch
+		}
+		c.Updated = time.Now()
+		position, done := c.Position, c.Done
+		state.Unlock()
+		job.Logger.Info("backfill progress", "order", run.Backfill.Order, "position", position, "done", done, "batch_finished", finished)
 	}
 
 	// =========================================================
 	// ================ List Downloaded Files ==================
 	// =========================================================
 
-	log.Println("-----		")
-	log.Println("-----		List Downloaded Files")
-	log.Println("-----		")
-	directory := sMediaFolder + pChannelID
+	// The downloads yt-dlp reported, then anything an interrupted run left
+	// behind without numbering it
+	directory := channel.MediaFolder + channel.ChannelID
 	descfiles, descerr := WalkMatch(directory+"/", "*.description")
 
 	if descerr != nil {
-		log.Printf("------------------      START List Downloaded Files ERROR")
-		// log.Printf("%s", descerr)
-		log.Fatal(descerr)
-		log.Printf("------------------      END List Downloaded Files ERROR")
+		logger.Error("listing downloaded files failed", "phase", "list", "dir", directory, "error", descerr)
+		return fmt.Errorf("listing downloaded files: %w", descerr)
 	}
 
-	log.Println("-----		")
-	log.Println("-----		List Files to add to RSS Feed")
-	log.Println("-----		")
+	downloads := append([]DownloadResult{}, results...)
+	reported := map[string]bool{}
+	for _, d := range results {
+		reported[d.Description] = true
+	}
 	for _, fname := range descfiles {
+		if reported[fname] == false {
+			downloads = append(downloads, resultFor(filepath.Dir(fname)+"/", strings.TrimSuffix(filepath.Base(fname), ".description"), channel.FileFormat))
+		}
+	}
+
+	// Episode numbers follow publication, not download or file name order
+	SortByPublished(downloads)
+
+	numbered := 0
+	for _, download := range downloads {
+		if ctx.Err() != nil {
+			logger.Warn("run stopped, leaving downloads for the next run", "phase", "list", "error", ctx.Err())
+			return ctx.Err()
+		}
+
 		// ------- Get Files ---------
-		arrfname_noext := strings.Split(fname, ".")
-		fname_noext := arrfname_noext[0]
-		fname_json := fname_noext + ".info.json"
+		fname_noext := strings.TrimSuffix(download.InfoJSON, ".info.json")
+		fname_json := download.InfoJSON
 		fname_mp3 := fname_noext + ".mp3"
-		fname_mp4 := fname_noext + ".mp4"
-		fname_description := fname_noext + ".description"
-
-		log.Println("fname_noext: " + fname_noext)
-		log.Println("fname_mp3: " + fname_mp3)
-		log.Println("fname_mp4: " + fname_mp4)
-		log.Println("fname_description: " + fname_description)
-		log.Println("fname_json: " + fname_json)
+		fname_mp4 := download.Media
+		fname_description := download.Description
 
 		//  Check if Paths are Valid --
 		filename_json_isfile := IsValid(fname_json)
 		filename_mp3_isfile := IsValid(fname_mp3)
 		filename_mp4_isfile := IsValid(fname_mp4)
 
-		if filename_json_isfile == true {
-			log.Println("The JSON file is present.")
-		}
-		if filename_mp3_isfile == true {
-			log.Println("The MP3 file is present.")
-			// filename_ext := fname_mp3
-		}
-		if filename_mp4_isfile == true {
-			log.Println("The MP4 file is present.")
-			// filename_ext := fname_mp4
-		}
-
-		log.Println("-----		")
-		log.Println("-----		Get JSON Information")
-		log.Println("-----		")
+		logger.Debug("found downloaded files", "phase", "list", "file", fname_noext, "description", fname_description, "json", filename_json_isfile, "mp3", filename_mp3_isfile, "mp4", filename_mp4_isfile)
 
 		if filename_json_isfile == true && filename_mp4_isfile == true {
 			// //  Open and Read JSON file --
 			// Let's first read the `config.json` file
 			content, contenterr := ioutil.ReadFile(fname_json)
 			if contenterr != nil {
-				log.Fatal("Error when opening file: ", contenterr)
+				logger.Error("opening info.json failed", "phase", "metadata", "file", fname_json, "error", contenterr)
+				return fmt.Errorf("opening %s: %w", fname_json, contenterr)
 			}
 
 			// defining a map
@@ -418,7 +730,18 @@ func Run_YTDLP(sMediaFolder string, Config string, pName string, pChannelID stri
 			if maperr != nil {
 				// print out if error is not nil
 				// fmt.Println(maperr)
-				log.Fatal("Error reading JSON File ", maperr)
+				logger.Error("reading info.json failed", "phase", "metadata", "file", fname_json, "error", maperr)
+				return fmt.Errorf("reading %s: %w", fname_json, maperr)
+			}
+
+			// yt-dlp filtered already, but cannot when it does not know a
+			// value up front; the video stays in the archive
+			if reason := run.Filter.Check(mapresult); reason != "" {
+				logger.Info("video filtered out, removing it", "phase", "filter", "video_id", mapresult["id"], "reason", reason)
+				for _, fname := range []string{fname_mp4, fname_json, fname_description} {
+					os.Remove(fname)
+				}
+				continue
 			}
 
 			var jsonpayload JsonData
@@ -445,35 +768,41 @@ func Run_YTDLP(sMediaFolder string, Config string, pName string, pChannelID stri
 			// Filesize = (float64(jsonpayload.filesize_approx) / 1024) / 1024
 			// jsonpayload.filesize_approx = roundFloat(Filesize, 2)
 
+			videoLogger := logger.With("video_id", jsonpayload.id)
+
 			// -- Test Thumbnail Path ----
-			ytvideo_thumbnail := "https://i.ytimg.com/vi_webp/" + jsonpayload.id + "/maxresdefault.webp"
-			ValidURI := IsValidURL(ytvideo_thumbnail)
-			if ValidURI == true {
-				jsonpayload.thumbnail = ytvideo_thumbnail
-			}
+			if ThumbnailHost != "" {
+				ytvideo_thumbnail := ThumbnailHost + "/vi_webp/" + jsonpayload.id + "/maxresdefault.webp"
+				ValidURI := IsValidURL(ctx, videoLogger, ytvideo_thumbnail)
+				if ValidURI == true {
+					jsonpayload.thumbnail = ytvideo_thumbnail
+				}
 
-			ytvideo_thumbnail2 := "https://i.ytimg.com/vi_webp/" + jsonpayload.id + "/maxresdefault.jpg"
-			ValidURI2 := IsValidURL(ytvideo_thumbnail2)
-			if ValidURI2 == true {
-				jsonpayload.thumbnail = ytvideo_thumbnail2
+				ytvideo_thumbnail2 := ThumbnailHost + "/vi_webp/" + jsonpayload.id + "/maxresdefault.jpg"
+				ValidURI2 := IsValidURL(ctx, videoLogger, ytvideo_thumbnail2)
+				if ValidURI2 == true {
+					jsonpayload.thumbnail = ytvideo_thumbnail2
+				}
 			}
 
 			// =========================================================
 			// ============ Validate Episode Number File ===============
 			// =========================================================
 
-			channelEpisodeNumberPath := Config + pChannelID + "_EpisodeNumber.txt"
+			channelEpisodeNumberPath := run.Config + channel.ChannelID + "_EpisodeNumber.txt"
 			channelEpisodeNumberPath_Valid := IsValid(channelEpisodeNumberPath)
 
 			if channelEpisodeNumberPath_Valid == false {
 				if writersserr := os.WriteFile(channelEpisodeNumberPath, []byte("0"), 0666); writersserr != nil {
-					log.Fatal(writersserr)
+					videoLogger.Error("creating episode number file failed", "phase", "number", "file", channelEpisodeNumberPath, "error", writersserr)
+					return fmt.Errorf("creating episode number file: %w", writersserr)
 				}
 			}
 
 			epContent, epErr := ioutil.ReadFile(channelEpisodeNumberPath) // the file is inside the local directory
 			if epErr != nil {
-				log.Fatal(epErr)
+				videoLogger.Error("reading episode number file failed", "phase", "number", "file", channelEpisodeNumberPath, "error", epErr)
+				return fmt.Errorf("reading episode number file: %w", epErr)
 			}
 			channelEpisodeNumbertmp := strings.TrimSpace(string(epContent))
 			channelEpisodeNumber, interr := strconv.ParseInt(channelEpisodeNumbertmp, 10, 64)
@@ -481,20 +810,12 @@ func Run_YTDLP(sMediaFolder string, Config string, pName string, pChannelID stri
 			channelEpisodeNumberStr := fmt.Sprintf("%02d", channelEpisodeNumber)
 
 			if interr != nil {
-				log.Printf("------------------      START strconv.ParseInt ERROR")
-				log.Fatal(interr.Error())
-				log.Printf("------------------      END strconv.ParseInt ERROR")
+				videoLogger.Error("episode number file is not a number", "phase", "number", "file", channelEpisodeNumberPath, "error", interr)
+				return fmt.Errorf("episode number file %s: %w", channelEpisodeNumberPath, interr)
 			}
 
-			log.Printf("channelEpisodeNumberPath: " + channelEpisodeNumberPath)
-			log.Printf("channelEpisodeNumber_Valid: " + fmt.Sprint(channelEpisodeNumberPath_Valid))
-			log.Printf("channelEpisodeNumber: '" + fmt.Sprint(channelEpisodeNumber) + "'")
-			log.Printf("channelEpisodeNumberStr: '" + channelEpisodeNumberStr + "'")
-
-			// ~~~~~~~ Write New Episode Number ~~~~~~~~~
-			if writersserr := os.WriteFile(channelEpisodeNumberPath, []byte(fmt.Sprint(channelEpisodeNumber)), 0666); writersserr != nil {
-				log.Fatal(writersserr)
-			}
+			videoLogger = videoLogger.With("episode", "s01e"+channelEpisodeNumberStr)
+			videoLogger.Debug("episode number assigned", "phase", "number", "file", channelEpisodeNumberPath, "existed", channelEpisodeNumberPath_Valid)
 
 			// ~~~~~~ Download Episode Thumbnail ~~~~~~~~
 
@@ -511,188 +832,288 @@ func Run_YTDLP(sMediaFolder string, Config string, pName string, pChannelID stri
 				savename = "s01e" + channelEpisodeNumberStr + " - " + jsonpayload.id + ".jpg"
 			}
 
-			err := DownloadFile(sMediaFolder+pChannelID+"/Season_1/"+savename, jsonpayload.thumbnail)
+			err := DownloadFile(ctx, channel.MediaFolder+channel.ChannelID+"/Season_1/"+savename, jsonpayload.thumbnail)
+			if err != nil && ctx.Err() != nil {
+				videoLogger.Warn("run stopped, leaving the download for the next run", "phase", "artwork", "error", ctx.Err())
+				return ctx.Err()
+			}
 			if err != nil {
-				// panic(err)
-				log.Printf("------------------      START DownloadFile ERROR")
-				log.Fatal(err.Error())
-				log.Printf("------------------      END DownloadFile ERROR")
+				videoLogger.Error("downloading thumbnail failed", "phase", "artwork", "url", jsonpayload.thumbnail, "error", err)
+				return fmt.Errorf("downloading thumbnail of %s: %w", jsonpayload.id, err)
+			}
+			videoLogger.Debug("thumbnail downloaded", "phase", "artwork", "url", jsonpayload.thumbnail, "file", savename)
+
+			// ~~~~~~~ Write New Episode Number ~~~~~~~~~
+			// Only once nothing else can fail, so a failed video does not
+			// leave a gap in the numbering
+			if writersserr := os.WriteFile(channelEpisodeNumberPath, []byte(fmt.Sprint(channelEpisodeNumber)), 0666); writersserr != nil {
+				videoLogger.Error("writing episode number file failed", "phase", "number", "file", channelEpisodeNumberPath, "error", writersserr)
+				return fmt.Errorf("writing episode number file: %w", writersserr)
 			}
-			fmt.Println("Downloaded: " + jsonpayload.thumbnail)
 
 			// ~~~~~~~~~~~ Rename MP4 File ~~~~~~~~~~~~~~
 
 			// dlname2 := pChannelID + "/Season_1/s01e" + channelEpisodeNumberStr + " - %(id)s.%(ext)s"
-			os.Rename(sMediaFolder+pChannelID+"/Season_1/"+jsonpayload.id+".mp4", sMediaFolder+pChannelID+"/Season_1/s01e"+channelEpisodeNumberStr+" - "+jsonpayload.id+".mp4")
+			os.Rename(fname_mp4, channel.MediaFolder+channel.ChannelID+"/Season_1/s01e"+channelEpisodeNumberStr+" - "+jsonpayload.id+filepath.Ext(fname_mp4))
+			numbered++
 
 			// --- Print Final Data ------
 
-			log.Printf("jsonpayload.id: " + jsonpayload.id)
-			log.Printf("jsonpayload.title: " + jsonpayload.title)
-			log.Printf("jsonpayload.thumbnail: " + jsonpayload.thumbnail)
-			// log.Printf("jsonpayload.description: " + jsonpayload.description)
-			log.Printf("jsonpayload.uploader_url: " + jsonpayload.uploader_url)
-			log.Printf("jsonpayload.channel_url: " + jsonpayload.channel_url)
-			log.Printf("jsonpayload.webpage_url: " + jsonpayload.webpage_url)
-			log.Printf("jsonpayload.duration_string: " + jsonpayload.duration_string)
-			// log.Printf("jsonpayload.filesize_approx: " + fmt.Sprint(jsonpayload.filesize_approx))
+			videoLogger.Info("episode downloaded", "phase", "rename", "title", jsonpayload.title, "duration", jsonpayload.duration_string, "url", jsonpayload.webpage_url)
+			videoLogger.Debug("episode metadata", "phase", "rename", "thumbnail", jsonpayload.thumbnail, "uploader_url", jsonpayload.uploader_url, "channel_url", jsonpayload.channel_url)
 
 			// =========================================================
 			// =================== Notify Pushover =====================
 			// =========================================================
 
-			NotifyPushover(Config, pPushoverAppToken, pPushoverUserToken, "RSS Podcast Downloaded ("+pName+")", "<html><body>"+jsonpayload.title+"<br /><br />--------------------------------------------<br /><br />"+jsonpayload.description+"</body></html>", jsonpayload.thumbnail, jsonpayload.webpage_url)
+			run.Notifier.Send(ctx, Notification{
+				Channel:    channel.Name,
+				AppToken:   channel.PushoverAppToken,
+				UserToken:  channel.PushoverUserToken,
+				Title:      "RSS Podcast Downloaded (" + channel.Name + ")",
+				Summary:    channel.Name + ": " + jsonpayload.title,
+				Body:       "<html><body>" + jsonpayload.title + "<br /><br />--------------------------------------------<br /><br />" + jsonpayload.description + "</body></html>",
+				Attachment: channel.MediaFolder + channel.ChannelID + "/Season_1/" + savename,
+				URL:        jsonpayload.webpage_url,
+				Priority:   channel.PushoverPriority,
+				Sound:      channel.PushoverSound,
+			})
+		}
+	}
+
+	// A backfill brings in videos older than episodes already numbered
+	if run.Backfill.Order != "" && numbered > 0 {
+		if err := RenumberEpisodes(logger.With("phase", "number"), channel.MediaFolder+channel.ChannelID+"/Season_1"); err != nil {
+			logger.Error("renumbering episodes failed", "phase", "number", "error", err)
+			return fmt.Errorf("renumbering episodes: %w", err)
 		}
 	}
+	return nil
 }
 
-func main() {
-	// name := "Go Developers"
-	// log.Println("Hello World:", name)
-	xmlFile, err := os.Open("/config/settings.xml")
-	// xmlFile, err := os.Open("settingsLOCAL.xml")
-	if err != nil {
-		log.Println(err)
+// RunChannels downloads every PodcastDownload that passed validation, or only
+// those in selected when it is not nil. Invalid channels are reported and
+// skipped so they cannot hold up the others. With a videoURL the selected
+// channel fetches just that video, through the same naming, numbering,
+// artwork and notification steps, and channel health is left alone. The run
+// stops when ctx is done or RunTimeout passes, leaving whatever is unfinished
+// for the next one. It returns how many channels failed, were skipped as
+// invalid or were not reached.
+func RunChannels(ctx context.Context, settingsXML settings, report ValidationReport, selected []int, videoURL string) int {
+	if selected == nil {
+		for i := range settingsXML.PodcastDownload {
+			selected = append(selected, i)
+		}
+	}
+
+	// Validation stops a run with bad global settings before it gets here;
+	// should one slip through, no channel runs on half-read settings
+	timeouts, timeoutserr := LoadTimeouts(settingsXML)
+	ownership, ownershiperr := LoadOwnership(settingsXML)
+	retry, retryerr := LoadRetryPolicy(settingsXML)
+	workers, workerserr := LoadWorkers(settingsXML)
+	if err := errors.Join(timeoutserr, ownershiperr, retryerr, workerserr); err != nil {
+		slog.Error("global settings not valid, not running any channels", "phase", "validate", "error", err)
+		return len(selected)
 	}
-	// log.Println("Successfully Opened users.xml")
 
-	// read our opened xmlFile as a byte array.
-	byteValue, _ := ioutil.ReadAll(xmlFile)
+	ctx, cancel := WithTimeout(ctx, timeouts.Run)
+	defer cancel()
 
-	// we initialize our PodcastDownload array
-	var settingsXML settings
-	var validateXML Validate
-	// we unmarshal our byteArray which contains our
-	// xmlFiles content into 'users' which we defined above
-	xml.Unmarshal(byteValue, &settingsXML)
+	state, stateerr := LoadState(settingsXML.Config)
+	if stateerr != nil {
+		Fatal(slog.Default(), "reading state file failed", "phase", "state", "error", stateerr)
+	}
+	alertWindow := FailureAlertWindow(settingsXML.FailureAlertWindow)
+	notifier := &Notifier{Config: settingsXML.Config, Location: LoadLocation(settingsXML.TimeZone), QuietHours: settingsXML.QuietHours, State: state}
+	notifier.Deliver(ctx)
+	if saveerr := state.Save(settingsXML.Config); saveerr != nil {
+		slog.Error("writing state file failed", "phase", "state", "error", saveerr)
+	}
+	downloadSlots := NewLimiter(workers.Downloads)
 
-	log.Println("Email: " + settingsXML.Email)
-	log.Println("MediaFolder: " + settingsXML.MediaFolder)
-	log.Println("PushoverUserToken: " + settingsXML.PushoverUserToken)
-	log.Println("Config: " + settingsXML.Config)
+	// ########################################################################
+	// ######################## Loop PodcastDownload ##########################
+	// ########################################################################
 
-	// =========================================================
-	// ================== Validate Settings ====================
-	// =========================================================
+	// runChannel processes one channel, reporting whether it failed
+	runChannel := func(i int) bool {
+		channel, _ := ResolveChannel(settingsXML, settingsXML.PodcastDownload[i])
+		logger := slog.With("channel", channel.Name)
 
-	log.Println()
-	validateXML.MediaFolder = IsValid(settingsXML.MediaFolder)
-	validateXML.Config = IsValid(settingsXML.Config)
+		if ctx.Err() != nil {
+			logger.Warn("run stopped before the channel", "phase", "start", "error", ctx.Err())
+			return true
+		}
 
-	if settingsXML.PlaylistItems == "" {
-		validateXML.PlaylistItems = false
-	} else {
-		validateXML.PlaylistItems = true
+		if channel.Disabled {
+			logger.Info("skipping disabled channel", "phase", "start")
+			return false
+		}
+		if report.ChannelValid(i) == false {
+			logger.Error("skipping channel with invalid settings", "phase", "validate", "problems", len(report.Channels[i]))
+			return true
+		}
+
+		youtubeURL := channel.YouTubeURL
+		if videoURL != "" {
+			youtubeURL = videoURL
+			// Fetching a video on purpose tries it again even if it was skipped
+			if id, ok := VideoIDFromURL(videoURL); ok {
+				youtubeURL = watchURL(id)
+				state.Lock()
+				delete(state.SkippedVideos, id)
+				state.Unlock()
+			}
+		}
+		logger.Info("processing channel", "phase", "start", "channel_id", channel.ChannelID, "youtube_url", youtubeURL)
+
+		filter, filtererr := LoadFilter(channel, time.Now())
+		backfill, backfillerr := LoadBackfill(channel)
+		if err := errors.Join(filtererr, backfillerr); err != nil {
+			logger.Error("skipping channel with invalid settings", "phase", "validate", "error", err)
+			return true
+		}
+		if videoURL != "" {
+			// A video fetched on purpose downloads now
+			channel.YouTubeURL = youtubeURL
+			backfill = Backfill{}
+			channel.DownloadWindow, channel.BacklogWindow = "", ""
+		}
+		runErr := PrepareChannel(ownership, channel)
+		if runErr != nil {
+			logger.Error("creating channel folders failed", "phase", "start", "error", runErr)
+		} else {
+			run := ChannelRun{Config: settingsXML.Config, Filter: filter, Backfill: backfill, Notifier: notifier, Retry: retry, VideoTimeout: timeouts.Video, DownloadSlots: downloadSlots}
+			runErr = Run_YTDLP(ctx, channel, run)
+		}
+
+		// A single video failing says nothing about the channel, and neither
+		// does the run being stopped
+		switch {
+		case videoURL != "":
+			if runErr != nil {
+				logger.Error("fetching video failed", "phase", "download", "video_url", videoURL, "error", runErr)
+			}
+		case ctx.Err() != nil:
+			logger.Warn("run stopped during the channel", "phase", "download", "error", ctx.Err())
+		default:
+			ReportChannelHealth(ctx, notifier, alertWindow, channel.PushoverAppToken, channel.PushoverUserToken, channel.PushoverPriority, channel.PushoverSound, channel.Name, channel.ChannelID, runErr)
+		}
+		if saveerr := state.Save(settingsXML.Config); saveerr != nil {
+			logger.Error("writing state file failed", "phase", "state", "error", saveerr)
+		}
+
+		if runErr == nil && videoURL == "" && ctx.Err() == nil {
+			retention, _ := ParseRetention(channel.Retention)
+			DeleteOldFiles(logger, channel.MediaFolder+channel.ChannelID+"/", retention)
+		}
+		return runErr != nil
 	}
 
-	if settingsXML.PushoverUserToken == "" {
-		validateXML.PushoverUserToken = false
-	} else {
-		validateXML.PushoverUserToken = true
+	// ChannelWorkers channels run side by side, taking the next one in
+	// settings order as they finish
+	queue := make(chan int)
+	var failed atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < workers.Channels; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				if runChannel(i) {
+					failed.Add(1)
+				}
+			}
+		}()
+	}
+	for _, i := range selected {
+		queue <- i
 	}
+	close(queue)
+	wg.Wait()
 
-	// ~~~~~~~~ Print Validation Data ~~~~~~~~~~~
+	return int(failed.Load())
+}
 
-	log.Println("MediaFolder Valid: " + fmt.Sprint(validateXML.MediaFolder))
-	log.Println("Config Valid: " + fmt.Sprint(validateXML.Config))
-	log.Println("PushoverUserToken Valid: " + fmt.Sprint(validateXML.PushoverUserToken))
-	log.Println("PlaylistItems Valid: " + fmt.Sprint(validateXML.PlaylistItems))
+func main() {
+	SetupLogging("", "")
+
+	opts, flagerr := ParseFlags(os.Args[1:])
+	if flagerr == flag.ErrHelp {
+		return
+	}
+	if flagerr != nil {
+		os.Exit(2)
+	}
+
+	// SIGINT and SIGTERM stop the run cleanly, along with any yt-dlp
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	opts.ConfigPath = FindSettings(opts.ConfigPath)
+	if opts.FakeFixtures != "" {
+		// Fixtures bring their own artwork, and notifications go nowhere
+		// unless asked
+		ActiveDownloader = &FakeDownloader{Fixtures: opts.FakeFixtures}
+		ThumbnailHost = ""
+		PushoverEndpoint = ""
+	}
+	if opts.PushoverURL != "" {
+		PushoverEndpoint = opts.PushoverURL
+	}
+
+	if opts.Command == "config" {
+		os.Exit(ConfigCommand(opts, os.Stdout, os.Stderr))
+	}
+	if opts.Command == "channel" {
+		os.Exit(ChannelCommand(ctx, opts, os.Stdout, os.Stderr))
+	}
+
+	settingsXML, err := LoadSettings(opts.ConfigPath)
+	if err != nil {
+		Fatal(slog.Default(), "reading settings failed", "phase", "config", "settings", opts.ConfigPath, "error", err)
+	}
+	RegisterSettingsSecrets(settingsXML)
+	if logerr := SetupLogging(settingsXML.LogLevel, settingsXML.LogFormat); logerr != nil {
+		slog.Warn("logging settings not valid", "phase", "config", "error", logerr)
+	}
+	ResolveSettingsChannelIDs(ctx, &settingsXML)
+
+	slog.Debug("settings loaded", "phase", "config", "settings", opts.ConfigPath, "email", settingsXML.Email, "media_folder", settingsXML.MediaFolder, "pushover_user_token", settingsXML.PushoverUserToken, "config", settingsXML.Config)
 
 	// =========================================================
-	// =========================================================
+	// ================== Validate Settings ====================
 	// =========================================================
 
-	// ########################################################################
-	// ######################## Loop PodcastDownload ##########################
-	// ########################################################################
+	report := ValidateSettings(settingsXML)
 
-	if validateXML.MediaFolder == true && validateXML.Config == true && validateXML.PushoverUserToken == true && validateXML.PlaylistItems == true {
-		log.Println("-----		")
-		log.Println("-----		Start Validate")
-		log.Println("-----		")
-		log.Println("Valid - MediaFolder")
-		log.Println("Valid - RSSFolder")
-		log.Println("Valid - RSSTemplate")
-		log.Println("Valid - Config")
-		// we iterate through every user within our users array and
-		// print out the user Type, their name, and their facebook url
-		// as just an example
-		for i := 0; i < len(settingsXML.PodcastDownload); i++ {
-			if settingsXML.PodcastDownload[i].Name == "" && settingsXML.PodcastDownload[i].ChannelID == "" && settingsXML.PodcastDownload[i].ChannelThumbnail == "" && settingsXML.PodcastDownload[i].DownloadArchive == "" && settingsXML.PodcastDownload[i].FileFormat == "" && settingsXML.PodcastDownload[i].FileQuality == "" && settingsXML.PlaylistItems == "" && settingsXML.PodcastDownload[i].YouTubeURL == "" && settingsXML.PodcastDownload[i].PushoverAppToken == "" {
-				validateXML.PodcastDownload_Name = false
-				validateXML.PodcastDownload_ChannelID = false
-				validateXML.PodcastDownload_DownloadArchive = false
-				validateXML.PodcastDownload_FileFormat = false
-				validateXML.PodcastDownload_FileQuality = false
-				validateXML.PodcastDownload_YouTubeURL = false
-				validateXML.PlaylistItems = false
-				log.Println("Not Valid - PodcastDownload_Name")
-				log.Println("Not Valid - PodcastDownload_ChannelID")
-				log.Println("Not Valid - PodcastDownload_DownloadArchive")
-				log.Println("ot Valid - PodcastDownload_FileFormat")
-				log.Println("Not Valid - PodcastDownload_FileQuality")
-				log.Println("Not Valid - PodcastDownload_YouTubeURL")
-				log.Println("Not Valid - PlaylistItems")
-			} else {
-				validateXML.PodcastDownload_DownloadArchive = IsValid(settingsXML.PodcastDownload[i].DownloadArchive)
-				if validateXML.PodcastDownload_DownloadArchive == true {
-					validateXML.PodcastDownload_Name = true
-					validateXML.PodcastDownload_ChannelID = true
-					validateXML.PodcastDownload_FileFormat = true
-					validateXML.PodcastDownload_FileQuality = true
-					validateXML.PodcastDownload_YouTubeURL = true
-					validateXML.PlaylistItems = true
-					log.Println("Valid - PodcastDownload_Name")
-					log.Println("Valid - PodcastDownload_ChannelID")
-					log.Println("Valid - PodcastDownload_DownloadArchive")
-					log.Println("Valid - PodcastDownload_FileFormat")
-					log.Println("Valid - PodcastDownload_FileQuality")
-					log.Println("Valid - PodcastDownload_YouTubeURL")
-					log.Println("Valid - PlaylistItems")
-				} else {
-					log.Println("Valid - PodcastDownload_Name")
-					log.Println("Valid - PodcastDownload_ChannelID")
-					log.Println("Not Valid - PodcastDownload_DownloadArchive")
-					log.Println("Valid - PodcastDownload_FileFormat")
-					log.Println("Valid - PodcastDownload_FileQuality")
-					log.Println("Valid - PodcastDownload_YouTubeURL")
-					log.Println("Valid - PlaylistItems")
-				}
-			}
-			log.Println("-----		")
-			log.Println("-----		End Validate")
-			log.Println("-----		")
-			log.Println("")
+	if opts.Command == "validate" {
+		os.Exit(PrintValidation(os.Stdout, settingsXML, report))
+	}
 
-			// =========================================================
-			// =================== Check All Valid =====================
-			// =========================================================
+	for _, problem := range report.Problems() {
+		slog.Error("setting not valid", "phase", "validate", "channel", problem.Channel, "field", problem.Field, "problem", problem.Message)
+	}
+	if len(report.Global) > 0 {
+		Fatal(slog.Default(), "global settings not valid, not running any channels", "phase", "validate", "problems", len(report.Global))
+	}
 
-			if validateXML.MediaFolder == true && validateXML.PodcastDownload_ChannelID == true && validateXML.PodcastDownload_DownloadArchive == true && validateXML.PodcastDownload_FileFormat == true && validateXML.PodcastDownload_FileQuality == true && validateXML.PodcastDownload_Name == true && validateXML.PlaylistItems == true && validateXML.PodcastDownload_YouTubeURL == true {
-				log.Println("-----		")
-				log.Println("-----		PodcastDownload")
-				log.Println("-----		")
-				log.Println("PodcastDownload.Name: " + settingsXML.PodcastDownload[i].Name)
-				log.Println("PodcastDownload.ChannelID: " + settingsXML.PodcastDownload[i].ChannelID)
-				log.Println("PodcastDownload.ChannelThumbnail: " + settingsXML.PodcastDownload[i].ChannelThumbnail)
-				log.Println("PodcastDownload.DownloadArchive: " + settingsXML.PodcastDownload[i].DownloadArchive)
-				log.Println("PodcastDownload.FileFormat: " + settingsXML.PodcastDownload[i].FileFormat)
-				log.Println("PodcastDownload.FileQuality: " + settingsXML.PodcastDownload[i].FileQuality)
-				log.Println("PodcastDownload.YouTubeURL: " + settingsXML.PodcastDownload[i].YouTubeURL)
-				log.Println("PlaylistItems: " + settingsXML.PlaylistItems)
-				log.Println("-----		")
-
-				Run_YTDLP(settingsXML.MediaFolder, settingsXML.Config, settingsXML.PodcastDownload[i].Name, settingsXML.PodcastDownload[i].ChannelID, settingsXML.PodcastDownload[i].FileFormat, settingsXML.PodcastDownload[i].DownloadArchive, settingsXML.PodcastDownload[i].FileQuality, settingsXML.PlaylistItems, settingsXML.PodcastDownload[i].YouTubeURL, settingsXML.PodcastDownload[i].PushoverAppToken, settingsXML.PushoverUserToken)
-				DeleteOldFiles(settingsXML.MediaFolder + settingsXML.PodcastDownload[i].ChannelID + "/")
-				log.Println("")
-			}
-		}
+	if opts.Command == "daemon" {
+		os.Exit(RunDaemon(ctx, opts, settingsXML, report, os.Stderr))
 	}
 
-	// ########################################################################
-	// ########################################################################
-	// ########################################################################
+	selected, videoURL, selecterr := SelectChannels(opts, settingsXML)
+	if selecterr != nil {
+		fmt.Fprintln(os.Stderr, selecterr)
+		os.Exit(2)
+	}
 
-	// defer the closing of our xmlFile so that we can parse it later on
-	defer xmlFile.Close()
+	failed := RunChannels(ctx, settingsXML, report, selected, videoURL)
+
+	// A full run reports failures through notifications; an on demand one
+	// also through its exit code
+	if selected != nil && failed > 0 {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeFixture adds a video with artwork to a FakeDownloader fixtures folder.
+func writeFixture(t *testing.T, dir string, id string, uploaded string) {
+	t.Helper()
+	info := `{"id": "` + id + `", "title": "Title ` + id + `", "description": "About ` + id + `", "webpage_url": "https://www.youtube.com/watch?v=` + id + `", "duration_string": "1:00", "duration": 600, "upload_date": "` + uploaded + `"}`
+	if err := os.WriteFile(filepath.Join(dir, id+".info.json"), []byte(info), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, id+".jpg"), []byte("artwork of "+id), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fakeChannel is a channel run through Run_YTDLP with the FakeDownloader,
+// in temporary fixtures, media and config folders. Pushover and thumbnail
+// lookups are off and each download is tried once; the package's injectable
+// globals are put back when the test ends.
+type fakeChannel struct {
+	Fixtures string
+	Config   string
+	Season   string
+	Archive  string
+	Channel  YouTubeDownload
+	Run      ChannelRun
+}
+
+func newFakeChannel(t *testing.T) *fakeChannel {
+	t.Helper()
+	tmp := t.TempDir()
+	media := filepath.Join(tmp, "media") + "/"
+	channelID := "UCtesttesttesttesttestte"
+	f := &fakeChannel{Fixtures: filepath.Join(tmp, "fixtures"), Config: filepath.Join(tmp, "config") + "/", Season: media + channelID + "/Season_1/"}
+	f.Archive = f.Config + channelID + ".archive"
+	for _, dir := range []string{f.Fixtures, f.Season, f.Config} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	savedDownloader, savedEndpoint, savedClient, savedHost := ActiveDownloader, PushoverEndpoint, PushoverClient, ThumbnailHost
+	t.Cleanup(func() {
+		ActiveDownloader, PushoverEndpoint, PushoverClient, ThumbnailHost = savedDownloader, savedEndpoint, savedClient, savedHost
+	})
+	ActiveDownloader = &FakeDownloader{Fixtures: f.Fixtures}
+	PushoverEndpoint = ""
+	ThumbnailHost = ""
+
+	state, err := LoadState(f.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Channel = YouTubeDownload{Name: "Test", ChannelID: channelID, FileFormat: "mkv", DownloadArchive: f.Archive, FileQuality: "best", PlaylistItems: "1-5", YouTubeURL: "https://www.youtube.com/channel/" + channelID, MediaFolder: media}
+	f.Run = ChannelRun{
+		Config:        f.Config,
+		Notifier:      &Notifier{Config: f.Config, Location: time.UTC, State: state},
+		Retry:         &RetryPolicy{Attempts: 1, Backoff: time.Millisecond, Budget: time.Second},
+		VideoTimeout:  time.Minute,
+		DownloadSlots: NewLimiter(1),
+	}
+	return f
+}
+
+// run runs the channel, failing the test if Run_YTDLP does.
+func (f *fakeChannel) run(t *testing.T) {
+	t.Helper()
+	if err := Run_YTDLP(context.Background(), f.Channel, f.Run); err != nil {
+		t.Fatalf("Run_YTDLP failed: %v", err)
+	}
+}
+
+// episodeNumber is the channel's episode number file.
+func (f *fakeChannel) episodeNumber() string {
+	number, _ := os.ReadFile(f.Config + f.Channel.ChannelID + "_EpisodeNumber.txt")
+	return strings.TrimSpace(string(number))
+}
+
+func TestRunYTDLPWithFakeDownloader(t *testing.T) {
+	f := newFakeChannel(t)
+	// Listed in ID order, but zzz went out first
+	writeFixture(t, f.Fixtures, "aaa", "20261010")
+	writeFixture(t, f.Fixtures, "zzz", "20261001")
+
+	// Pushover is down, so the notifications stay in the outbox
+	var mu sync.Mutex
+	var posted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		posted = append(posted, r.FormValue("title"))
+		mu.Unlock()
+		http.Error(w, "down", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	PushoverEndpoint = server.URL
+	PushoverClient = server.Client()
+	f.Channel.PushoverAppToken, f.Channel.PushoverUserToken = "app", "user"
+
+	f.run(t)
+
+	// Renamed and numbered in upload order, with the artwork alongside
+	want := []string{"s01e01 - zzz.jpg", "s01e01 - zzz.mkv", "s01e02 - aaa.jpg", "s01e02 - aaa.mkv"}
+	entries, err := os.ReadDir(f.Season)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var episodes []string
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), "s01e") {
+			episodes = append(episodes, e.Name())
+		}
+	}
+	sort.Strings(episodes)
+	if strings.Join(episodes, "|") != strings.Join(want, "|") {
+		t.Errorf("episode files = %q, want %q", episodes, want)
+	}
+	if artwork, _ := os.ReadFile(f.Season + "s01e02 - aaa.jpg"); string(artwork) != "artwork of aaa" {
+		t.Errorf("artwork of s01e02 = %q, want the fixture's", artwork)
+	}
+	if number := f.episodeNumber(); number != "2" {
+		t.Errorf("episode number file = %q, want 2", number)
+	}
+
+	outbox, err := ReadOutbox(f.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outbox) != 2 {
+		t.Fatalf("outbox has %d entries, want 2", len(outbox))
+	}
+	for i, id := range []string{"zzz", "aaa"} {
+		n := outbox[i].Notification
+		if n.Summary != "Test: Title "+id || n.UserToken != "user" || n.URL != "https://www.youtube.com/watch?v="+id {
+			t.Errorf("outbox entry %d = %+v, want the notification for %s", i, n, id)
+		}
+		if n.Attachment != f.Season+"s01e0"+string(rune('1'+i))+" - "+id+".jpg" {
+			t.Errorf("outbox entry %d attachment = %q", i, n.Attachment)
+		}
+		if outbox[i].Attempts != 1 || outbox[i].LastError == "" {
+			t.Errorf("outbox entry %d = %d attempts, error %q; want one failed attempt", i, outbox[i].Attempts, outbox[i].LastError)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(posted) == 0 || posted[0] != "RSS Podcast Downloaded (Test)" {
+		t.Errorf("Pushover posts = %q, want the first download's", posted)
+	}
+}
+
+func TestRunYTDLPDefersOutsideDownloadWindow(t *testing.T) {
+	f := newFakeChannel(t)
+	writeFixture(t, f.Fixtures, "aaa", "20261010")
+	state := f.Run.Notifier.State
+
+	// A window that closed an hour ago and opens again in two
+	now := time.Now().UTC()
+	f.Channel.DownloadWindow = now.Add(2*time.Hour).Format("15:04") + "-" + now.Add(-time.Hour).Format("15:04")
+	f.run(t)
+	if d, ok := state.DeferredVideos["aaa"]; ok == false || d.ChannelID != f.Channel.ChannelID || d.Uploaded.IsZero() {
+		t.Fatalf("deferred videos = %+v, want aaa recorded", state.DeferredVideos)
+	}
+	if readArchive(f.Archive)["aaa"] {
+		t.Errorf("deferred video was archived")
+	}
+
+	f.Channel.DownloadWindow = ""
+	f.run(t)
+	if len(state.DeferredVideos) != 0 {
+		t.Errorf("deferred videos = %+v, want none once downloaded", state.DeferredVideos)
+	}
+	if IsValid(f.Season+"s01e01 - aaa.mkv") == false {
+		t.Errorf("deferred video was not downloaded on the next run")
+	}
+}
+
+func TestRunYTDLPBackfillKeepsUploadOrder(t *testing.T) {
+	f := newFakeChannel(t)
+	f.Run.Backfill = Backfill{Order: BackfillOldest, Batch: 5}
+
+	// A new upload is downloaded while the backfill runs, and an older one
+	// found later takes its place in the numbering
+	writeFixture(t, f.Fixtures, "new", "20261010")
+	f.run(t)
+	if IsValid(f.Season+"s01e01 - new.mkv") == false {
+		t.Fatalf("new video was not downloaded during the backfill")
+	}
+	writeFixture(t, f.Fixtures, "old", "20250101")
+	f.run(t)
+
+	for _, name := range []string{"s01e01 - old.mkv", "s01e01 - old.jpg", "s01e02 - new.mkv", "s01e02 - new.jpg"} {
+		if IsValid(f.Season+name) == false {
+			t.Errorf("%s is missing", name)
+		}
+	}
+	if number := f.episodeNumber(); number != "2" {
+		t.Errorf("episode number file = %q, want 2", number)
+	}
+}
+
+func TestNotifyPushoverSendsAttachmentType(t *testing.T) {
+	artwork := filepath.Join(t.TempDir(), "s01e01 - aaa.jpg")
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4)), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(artwork, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var contentType, filename string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, header, err := r.FormFile("attachment"); err == nil {
+			contentType, filename = header.Header.Get("Content-Type"), header.Filename
+		}
+	}))
+	defer server.Close()
+
+	savedEndpoint, savedClient := PushoverEndpoint, PushoverClient
+	defer func() { PushoverEndpoint, PushoverClient = savedEndpoint, savedClient }()
+	PushoverEndpoint, PushoverClient = server.URL, server.Client()
+
+	if err := NotifyPushover(context.Background(), Notification{Title: "Title", Attachment: artwork}); err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "image/jpeg" || filename != "s01e01 - aaa.jpg" {
+		t.Errorf("attachment sent as %q named %q, want image/jpeg named after the artwork", contentType, filename)
+	}
+}
+
+func TestDeleteOldFilesRemovesWholeEpisodes(t *testing.T) {
+	season := filepath.Join(t.TempDir(), "media.v2", "UCtesttesttesttesttestte", "Season_1") + "/"
+	if err := os.MkdirAll(season, 0755); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	files := map[string]bool{
+		"aaa.description": true, "aaa.info.json": true, "s01e01 - aaa.mkv": true, "s01e01 - aaa.jpg": true,
+		"aaa-b.description": false, "s01e02 - aaa-b.mkv": false,
+		"bbb.description": false, "bbb.info.json": false, "s01e03 - bbb.mkv": false, "s01e03 - bbb.webp": false,
+	}
+	for name := range files {
+		if err := os.WriteFile(season+name, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chtimes(season+"aaa.description", old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	DeleteOldFiles(slog.Default(), filepath.Dir(filepath.Dir(season))+"/", 24*time.Hour)
+	for name, deleted := range files {
+		if IsValid(season+name) == deleted {
+			t.Errorf("%s: deleted = %v, want %v", name, IsValid(season+name) == false, deleted)
+		}
+	}
+}
+
+func TestRunChannelsStopsOnUnusableGlobalSettings(t *testing.T) {
+	s := settings{Config: t.TempDir() + "/", RetryAttempts: "none", PodcastDownload: []YouTubeDownload{{Name: "One"}, {Name: "Two"}}}
+	if failed := RunChannels(context.Background(), s, ValidationReport{}, nil, ""); failed != 2 {
+		t.Errorf("RunChannels = %d failed, want both channels", failed)
+	}
+	if IsValid(StatePath(s.Config)) {
+		t.Errorf("state was written although no channel ran")
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Backfill orders
+const (
+	BackfillOldest = "oldest"
+	BackfillNewest = "newest"
+)
+
+const DefaultBackfillBatch = 5
+
+// Backfill walks a channel's older uploads a batch per run, on top of the
+// new videos PlaylistItems finds. Oldest first starts at the channel's first
+// upload; newest first works back from the latest upload. Either way the
+// episodes are renumbered afterwards so they follow upload order. An empty
+// Order means no backfill.
+type Backfill struct {
+	Order string
+	Batch int
+}
+
+// BackfillCursor is how far a channel's backfill has got, kept in State by
+// ChannelID. Position counts playlist entries from the end the walk started
+// at.
+type BackfillCursor struct {
+	Order    string    `json:"Order"`
+	Position int       `json:"Position"`
+	Done     bool      `json:"Done,omitempty"`
+	Updated  time.Time `json:"Updated"`
+}
+
+// LoadBackfill reads a resolved channel's Backfill and BackfillBatch
+// settings.
+func LoadBackfill(channel YouTubeDownload) (Backfill, error) {
+	b := Backfill{Batch: DefaultBackfillBatch}
+
+	switch channel.Backfill {
+	case "", "off":
+	case BackfillOldest, BackfillNewest:
+		b.Order = channel.Backfill
+	default:
+		return b, settingError("Backfill", "%q is not oldest, newest or off", channel.Backfill)
+	}
+
+	if channel.BackfillBatch != "" {
+		batch, err := strconv.Atoi(channel.BackfillBatch)
+		if err != nil || batch < 1 {
+			return b, settingError("BackfillBatch", "%q is not a number of videos of 1 or more", channel.BackfillBatch)
+		}
+		b.Batch = batch
+	}
+	return b, nil
+}
+
+// Range is the --playlist-items of the batch after position. Counting from
+// the oldest end is stable as new videos are uploaded; counting from the
+// newest shifts, which only means seeing a few archived videos again.
+func (b Backfill) Range(position int) string {
+	if b.Order == BackfillOldest {
+		return fmt.Sprintf("-%d:-%d", position+b.Batch, position+1)
+	}
+	return fmt.Sprintf("%d:%d", position+1, position+b.Batch)
+}
+
+// Cursor returns the channel's cursor, starting over when the order has
+// changed. State must be locked.
+func (b Backfill) Cursor(state *State, channelID string) *BackfillCursor {
+	cursor, ok := state.Backfill[channelID]
+	if ok == false || cursor.Order != b.Order {
+		cursor = &BackfillCursor{Order: b.Order}
+		state.Backfill[channelID] = cursor
+	}
+	return cursor
+}
+
+var episodeFilePattern = regexp.MustCompile(`^s01e([0-9]+) - (.+)\.[^.]+$`)
+
+// RenumberEpisodes gives a season folder's episodes the numbers they already
+// have, reassigned in upload order, so older videos a backfill brings in are
+// not numbered after newer ones. An episode's upload date comes from the
+// <id>.info.json kept beside it; one without a date keeps its number. Only
+// the files of episodes whose number changes are renamed.
+func RenumberEpisodes(logger *slog.Logger, folder string) error {
+	files, err := filepath.Glob(filepath.Join(folder, "s01e* - *"))
+	if err != nil {
+		return err
+	}
+
+	type episode struct {
+		id        string
+		number    int
+		published time.Time
+		files     []string
+	}
+	byID := map[string]*episode{}
+	for _, fname := range files {
+		match := episodeFilePattern.FindStringSubmatch(filepath.Base(fname))
+		if match == nil {
+			continue
+		}
+		number, _ := strconv.Atoi(match[1])
+		ep, ok := byID[match[2]]
+		if ok == false {
+			ep = &episode{id: match[2], number: number, published: publishedAt(filepath.Join(folder, match[2]+".info.json"))}
+			byID[match[2]] = ep
+		}
+		if ep.number == number {
+			ep.files = append(ep.files, fname)
+		}
+	}
+
+	var episodes []*episode
+	var numbers []int
+	for _, ep := range byID {
+		if ep.published.IsZero() == false {
+			episodes = append(episodes, ep)
+			numbers = append(numbers, ep.number)
+		}
+	}
+	sort.Ints(numbers)
+	sort.Slice(episodes, func(i, j int) bool {
+		if episodes[i].published.Equal(episodes[j].published) {
+			return episodes[i].number < episodes[j].number
+		}
+		return episodes[i].published.Before(episodes[j].published)
+	})
+
+	for i, ep := range episodes {
+		if ep.number == numbers[i] {
+			continue
+		}
+		// Names also carry the video ID, so they cannot clash with another
+		// episode's while the numbers are being moved around
+		for _, fname := range ep.files {
+			rest := strings.TrimLeft(strings.TrimPrefix(filepath.Base(fname), "s01e"), "0123456789")
+			renamed := filepath.Join(folder, fmt.Sprintf("s01e%02d", numbers[i])+rest)
+			if err := os.Rename(fname, renamed); err != nil {
+				return err
+			}
+		}
+		logger.Info("episode renumbered to follow upload order", "video_id", ep.id, "from", ep.number, "to", numbers[i])
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestRenumberEpisodes(t *testing.T) {
+	season := t.TempDir()
+	files := map[string]string{
+		"new.info.json":       `{"upload_date": "20260110"}`,
+		"s01e01 - new.mkv":    "",
+		"s01e01 - new.jpg":    "",
+		"mid.info.json":       `{"upload_date": "20250601"}`,
+		"s01e02 - mid.mkv":    "",
+		"s01e03 - nodate.mkv": "",
+		"old.info.json":       `{"upload_date": "20250101", "timestamp": 1735732800}`,
+		"s01e04 - old.mkv":    "",
+		"s01e04 - old.webp":   "",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(season, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := RenumberEpisodes(slog.New(slog.NewTextHandler(io.Discard, nil)), season); err != nil {
+		t.Fatal(err)
+	}
+
+	// The dated episodes share 01, 02 and 04 in upload order; the undated
+	// one keeps 03
+	want := []string{"s01e01 - old.mkv", "s01e01 - old.webp", "s01e02 - mid.mkv", "s01e03 - nodate.mkv", "s01e04 - new.jpg", "s01e04 - new.mkv"}
+	matches, _ := filepath.Glob(filepath.Join(season, "s01e*"))
+	var got []string
+	for _, match := range matches {
+		got = append(got, filepath.Base(match))
+	}
+	sort.Strings(got)
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("episode files = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// ChannelMetadata is the part of yt-dlp's channel JSON that channel add uses.
+type ChannelMetadata struct {
+	ChannelID  string `json:"channel_id"`
+	Channel    string `json:"channel"`
+	Uploader   string `json:"uploader"`
+	Title      string `json:"title"`
+	Thumbnails []struct {
+		ID    string `json:"id"`
+		URL   string `json:"url"`
+		Width int    `json:"width"`
+	} `json:"thumbnails"`
+}
+
+// Name is the channel's display name.
+func (m ChannelMetadata) Name() string {
+	for _, name := range []string{m.Channel, m.Uploader, m.Title} {
+		if name != "" {
+			return name
+		}
+	}
+	return m.ChannelID
+}
+
+// Thumbnail is the channel's avatar, or else its widest thumbnail.
+func (m ChannelMetadata) Thumbnail() string {
+	best, width := "", -1
+	for _, t := range m.Thumbnails {
+		if t.ID == "avatar_uncropped" {
+			return t.URL
+		}
+		if t.Width > width {
+			best, width = t.URL, t.Width
+		}
+	}
+	return best
+}
+
+// channelList returns the PodcastDownload entries of a settings tree, which
+// a single-channel XML file holds as a mapping rather than a list.
+func channelList(tree *OrderedMap) (string, []any) {
+	key, value, found := tree.Lookup("PodcastDownload")
+	if found == false {
+		return "PodcastDownload", nil
+	}
+	switch t := value.(type) {
+	case []any:
+		return key, t
+	case nil:
+		return key, nil
+	default:
+		return key, []any{t}
+	}
+}
+
+func treeString(m *OrderedMap, key string) string {
+	_, value, _ := m.Lookup(key)
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// findChannel finds the entry whose Name or ChannelID is nameOrID.
+func findChannel(channels []any, nameOrID string) (int, *OrderedMap, error) {
+	for i, item := range channels {
+		m, ok := item.(*OrderedMap)
+		if ok == false {
+			continue
+		}
+		if treeString(m, "ChannelID") == nameOrID || strings.EqualFold(treeString(m, "Name"), nameOrID) {
+			return i, m, nil
+		}
+	}
+	return -1, nil, fmt.Errorf("no channel named %q or with that ChannelID", nameOrID)
+}
+
+// parseInterspersed parses flags that may come before or after the
+// positional arguments, which flag.Parse alone stops at.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+const channelUsage = `usage: DownloadYouTubePlexGo channel <command>
+
+  add <url> [--name name] [--disabled]   add a channel, looking it up with yt-dlp
+  list                                   list the channels
+  remove <name|channel id>               remove a channel
+  enable <name|channel id>               run a disabled channel again
+  disable <name|channel id>              stop running a channel but keep it`
+
+// ChannelCommand runs the channel subcommands, which edit the settings file
+// in place. It returns the exit code.
+func ChannelCommand(ctx context.Context, opts Options, stdout io.Writer, stderr io.Writer) int {
+	if len(opts.Args) == 0 {
+		fmt.Fprintln(stderr, channelUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("channel "+opts.Args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	name := fs.String("name", "", "name to use instead of the channel's own")
+	disabled := fs.Bool("disabled", false, "add the channel disabled")
+	args, err := parseInterspersed(fs, opts.Args[1:])
+	if err != nil {
+		return 2
+	}
+
+	command := opts.Args[0]
+	wantArgs := 1
+	if command == "list" {
+		wantArgs = 0
+	}
+	if len(args) != wantArgs || (command != "add" && (*name != "" || *disabled)) {
+		fmt.Fprintln(stderr, channelUsage)
+		return 2
+	}
+
+	tree, err := ReadSettingsTree(opts.ConfigPath)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	key, channels := channelList(tree)
+
+	switch command {
+	case "list":
+		w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tCHANNEL ID\tSTATUS\tURL")
+		for _, item := range channels {
+			m, ok := item.(*OrderedMap)
+			if ok == false {
+				continue
+			}
+			status := "enabled"
+			if strings.EqualFold(treeString(m, "Disabled"), "true") {
+				status = "disabled"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", treeString(m, "Name"), treeString(m, "ChannelID"), status, treeString(m, "YouTubeURL"))
+		}
+		w.Flush()
+		return 0
+
+	case "add":
+		if err := validateYouTubeURL(args[0]); err != nil {
+			fmt.Fprintln(stderr, "YouTubeURL:", err)
+			return 1
+		}
+		meta, err := ActiveDownloader.ChannelMetadata(ctx, args[0])
+		if err != nil {
+			fmt.Fprintln(stderr, "looking up the channel failed:", err)
+			return 1
+		}
+		if _, existing, err := findChannel(channels, meta.ChannelID); err == nil {
+			fmt.Fprintf(stderr, "%s is already in the settings as %q\n", meta.ChannelID, treeString(existing, "Name"))
+			return 1
+		}
+
+		entry := NewOrderedMap()
+		entry.Set("Name", meta.Name())
+		if *name != "" {
+			entry.Set("Name", *name)
+		}
+		entry.Set("ChannelID", meta.ChannelID)
+		entry.Set("YouTubeURL", args[0])
+		if thumbnail := meta.Thumbnail(); thumbnail != "" {
+			entry.Set("ChannelThumbnail", thumbnail)
+		}
+		if *disabled {
+			entry.Set("Disabled", true)
+		}
+		channels = append(channels, entry)
+		fmt.Fprintf(stdout, "added %s (%s)\n", treeString(entry, "Name"), meta.ChannelID)
+
+	case "remove", "enable", "disable":
+		i, m, err := findChannel(channels, args[0])
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		switch command {
+		case "remove":
+			// Comments before the channel, such as commented-out channels,
+			// move on to whatever follows it
+			if m.Notes != nil && len(m.Notes.Leading) > 0 {
+				next := tree
+				if i+1 < len(channels) {
+					if n, ok := channels[i+1].(*OrderedMap); ok {
+						next = n
+					}
+				}
+				if next == tree {
+					tree.notes().Trailing = append(m.Notes.Leading, tree.notes().Trailing...)
+				} else {
+					next.notes().Leading = append(m.Notes.Leading, next.notes().Leading...)
+				}
+			}
+			channels = append(channels[:i], channels[i+1:]...)
+		case "enable":
+			if k, _, found := m.Lookup("Disabled"); found {
+				m.Delete(k)
+			}
+		case "disable":
+			if k, _, found := m.Lookup("Disabled"); found {
+				m.Set(k, true)
+			} else {
+				m.Set("Disabled", true)
+			}
+		}
+		done := map[string]string{"remove": "removed", "enable": "enabled", "disable": "disabled"}[command]
+		fmt.Fprintf(stdout, "%s %s (%s)\n", done, treeString(m, "Name"), treeString(m, "ChannelID"))
+
+	default:
+		fmt.Fprintln(stderr, channelUsage)
+		return 2
+	}
+
+	tree.Set(key, channels)
+	if err := WriteSettingsTree(opts.ConfigPath, tree); err != nil {
+		fmt.Fprintln(stderr, "writing settings failed:", err)
+		return 1
+	}
+
+	// Point out anything a new channel still needs, such as a FileFormat
+	if s, err := ReadSettings(opts.ConfigPath); err == nil && command == "add" && len(s.PodcastDownload) > 0 {
+		report := ValidateSettings(s)
+		for _, problem := range report.Channels[len(s.PodcastDownload)-1] {
+			fmt.Fprintln(stderr, "warning: "+problem.String())
+		}
+	}
+	return 0
+}
+
+// FindChannelIndex finds the PodcastDownload whose Name or ChannelID is
+// nameOrID.
+func FindChannelIndex(s settings, nameOrID string) (int, error) {
+	for i, p := range s.PodcastDownload {
+		if p.ChannelID == nameOrID || strings.EqualFold(p.Name, nameOrID) {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("no channel named %q or with that ChannelID", nameOrID)
+}
+
+// SelectChannels reads the arguments of the run and fetch commands: run
+// [--channel name] and fetch <video url> --into <channel>. It returns the
+// channels to run, nil for all of them, and the video to fetch, if any.
+func SelectChannels(opts Options, s settings) ([]int, string, error) {
+	fs := flag.NewFlagSet(opts.Command, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	only := fs.String("channel", "", "")
+	into := fs.String("into", "", "")
+	args, err := parseInterspersed(fs, opts.Args)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var nameOrID, videoURL string
+	switch opts.Command {
+	case "run":
+		if len(args) > 0 || *into != "" {
+			return nil, "", fmt.Errorf("usage: DownloadYouTubePlexGo run [--channel name|channel id]")
+		}
+		if *only == "" {
+			return nil, "", nil
+		}
+		nameOrID = *only
+
+	case "fetch":
+		if len(args) != 1 || *into == "" || *only != "" {
+			return nil, "", fmt.Errorf("usage: DownloadYouTubePlexGo fetch <video url> --into <name|channel id>")
+		}
+		if err := validateYouTubeURL(args[0]); err != nil {
+			return nil, "", fmt.Errorf("video URL: %v", err)
+		}
+		if _, ok := VideoIDFromURL(args[0]); ok == false {
+			return nil, "", fmt.Errorf("video URL: %q is not a video's URL", args[0])
+		}
+		nameOrID, videoURL = *into, args[0]
+
+	default:
+		return nil, "", nil
+	}
+
+	i, err := FindChannelIndex(s, nameOrID)
+	if err != nil {
+		return nil, "", err
+	}
+	if s.PodcastDownload[i].Disabled {
+		return nil, "", fmt.Errorf("%s is disabled, enable it first with: channel enable %q", s.PodcastDownload[i].Name, nameOrID)
+	}
+	return []int{i}, videoURL, nil
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+const DefaultConfigPath = "/config/settings.xml"
+
+// SettingsFormats are the settings file formats, chosen by file extension.
+var SettingsFormats = map[string]string{
+	".xml":  "xml",
+	".yaml": "yaml",
+	".yml":  "yaml",
+	".toml": "toml",
+	".json": "json",
+}
+
+// EnvPrefix is the prefix of the environment variables that override global
+// settings: YTPLEX_ followed by the setting name in capitals, for example
+// YTPLEX_MEDIAFOLDER. Adding _FILE reads the value from a file instead, for
+// Docker secrets: YTPLEX_PUSHOVERUSERTOKEN_FILE=/run/secrets/pushover_user.
+const EnvPrefix = "YTPLEX_"
+
+// Options are the command line flags. Command is the subcommand, "run" when
+// none is given, and Args whatever follows it.
+type Options struct {
+	ConfigPath string
+	// FakeFixtures swaps yt-dlp for FakeDownloader serving this folder
+	FakeFixtures string
+	// PushoverURL replaces the Pushover API endpoint
+	PushoverURL string
+	Command     string
+	Args        []string
+}
+
+// ParseFlags reads the command line. The settings path can also be given as
+// YTPLEX_SETTINGS, as YTPLEX_CONFIG is the Config folder setting.
+func ParseFlags(args []string) (Options, error) {
+	var opts Options
+
+	defaultConfig := DefaultConfigPath
+	if env := os.Getenv(EnvPrefix + "SETTINGS"); env != "" {
+		defaultConfig = env
+	}
+
+	fs := flag.NewFlagSet("DownloadYouTubePlexGo", flag.ContinueOnError)
+	fs.StringVar(&opts.ConfigPath, "config", defaultConfig, "path to the settings file ($"+EnvPrefix+"SETTINGS)")
+	fs.StringVar(&opts.FakeFixtures, "fake-downloader", "", "serve videos from this fixtures folder instead of running yt-dlp, for testing")
+	fs.StringVar(&opts.PushoverURL, "pushover-url", "", "post notifications here instead of the Pushover API, for testing")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintln(out, "Usage: DownloadYouTubePlexGo [flags] [command]")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Commands:")
+		fmt.Fprintln(out, "  run [--channel name|channel id]")
+		fmt.Fprintln(out, "             download every valid channel, or just one (default)")
+		fmt.Fprintln(out, "  fetch <video url> --into <name|channel id>")
+		fmt.Fprintln(out, "             download a single video into a channel")
+		fmt.Fprintln(out, "  daemon [--interval 15m]")
+		fmt.Fprintln(out, "             run every interval, reloading the settings when they change")
+		fmt.Fprintln(out, "  validate   check the settings and report every problem")
+		fmt.Fprintln(out, "  channel add|list|remove|enable|disable")
+		fmt.Fprintln(out, "             manage the channels in the settings file")
+		fmt.Fprintln(out, "  config convert --to yaml|toml|json|xml [--out path] [--force]")
+		fmt.Fprintln(out, "             rewrite the settings file in another format")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Flags:")
+		fs.PrintDefaults()
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Global settings can be overridden with environment variables:")
+		for _, name := range settingNames() {
+			fmt.Fprintf(out, "  %s%s (or %s%s_FILE)\n", EnvPrefix, strings.ToUpper(name), EnvPrefix, strings.ToUpper(name))
+		}
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+
+	opts.Command = "run"
+	if fs.NArg() > 0 {
+		opts.Command = fs.Arg(0)
+		opts.Args = fs.Args()[1:]
+	}
+	switch opts.Command {
+	case "run", "fetch", "daemon", "validate", "config", "channel":
+	default:
+		fmt.Fprintln(fs.Output(), "unknown command: "+opts.Command)
+		fs.Usage()
+		return opts, fmt.Errorf("unknown command %q", opts.Command)
+	}
+	return opts, nil
+}
+
+// settingNames lists the global string settings that can be overridden.
+func settingNames() []string {
+	var names []string
+	t := reflect.TypeOf(settings{})
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Type.Kind() == reflect.String {
+			names = append(names, t.Field(i).Name)
+		}
+	}
+	return names
+}
+
+// SettingsFormat is the format of a settings file going by its extension.
+func SettingsFormat(path string) (string, error) {
+	format, ok := SettingsFormats[strings.ToLower(filepath.Ext(path))]
+	if ok == false {
+		return "", fmt.Errorf("%s: settings files must end in .xml, .yaml, .yml, .toml or .json", path)
+	}
+	return format, nil
+}
+
+// FindSettings returns path, or when path is the default settings.xml and it
+// does not exist, the first /config/settings.yaml, .yml, .toml or .json that
+// does.
+func FindSettings(path string) string {
+	if path != DefaultConfigPath || IsValid(path) {
+		return path
+	}
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, ext := range []string{".yaml", ".yml", ".toml", ".json"} {
+		if IsValid(base + ext) {
+			return base + ext
+		}
+	}
+	return path
+}
+
+// ReadSettings parses the settings file at path in the format its extension
+// names. A missing or unparsable file is an error; nothing is guessed.
+func ReadSettings(path string) (settings, error) {
+	var s settings
+
+	format, err := SettingsFormat(path)
+	if err != nil {
+		return s, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return s, err
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return s, err
+	}
+
+	if format == "xml" {
+		if err := xml.Unmarshal(content, &s); err != nil {
+			return s, fmt.Errorf("%s: %w", path, err)
+		}
+		return s, nil
+	}
+
+	tree, err := parseSettingsTree(format, content)
+	if err == nil {
+		err = DecodeTree(tree, &s)
+	}
+	if err != nil {
+		return s, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+func parseSettingsTree(format string, content []byte) (any, error) {
+	switch format {
+	case "xml":
+		return ParseXML(content)
+	case "yaml":
+		return ParseYAML(content)
+	case "toml":
+		return ParseTOML(content)
+	case "json":
+		return ParseJSON(content)
+	}
+	return nil, fmt.Errorf("unknown settings format %q", format)
+}
+
+// ReadSettingsTree parses the settings file into a document tree, for
+// commands that edit it and must keep settings they do not know about.
+func ReadSettingsTree(path string) (*OrderedMap, error) {
+	format, err := SettingsFormat(path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := parseSettingsTree(format, content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	m, ok := tree.(*OrderedMap)
+	if ok == false {
+		return nil, fmt.Errorf("%s: settings must be a mapping", path)
+	}
+	return m, nil
+}
+
+// WriteSettingsTree replaces the settings file with tree, in the same format
+// and with the same permissions. The previous file is kept as path.bak.
+func WriteSettingsTree(path string, tree *OrderedMap) error {
+	format, err := SettingsFormat(path)
+	if err != nil {
+		return err
+	}
+
+	var content []byte
+	switch format {
+	case "xml":
+		content, err = MarshalXML(tree, "settings")
+	case "yaml":
+		content = MarshalYAML(tree)
+	case "toml":
+		content, err = MarshalTOML(tree)
+	case "json":
+		content, err = MarshalJSON(tree)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Make sure the new file still loads before replacing the old one
+	var check settings
+	if parsed, err := parseSettingsTree(format, content); err != nil {
+		return fmt.Errorf("rewritten settings do not parse: %w", err)
+	} else if err := DecodeTree(parsed, &check); err != nil {
+		return fmt.Errorf("rewritten settings do not load: %w", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	old, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteFileAtomic(path+".bak", old, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return WriteFileAtomic(path, content, info.Mode().Perm())
+}
+
+// MarshalSettings writes settings in format, leaving out empty settings.
+func MarshalSettings(s settings, format string) ([]byte, error) {
+	switch format {
+	case "xml":
+		return MarshalXML(EncodeTree(s), "settings")
+	case "yaml":
+		return MarshalYAML(EncodeTree(s)), nil
+	case "toml":
+		return MarshalTOML(EncodeTree(s))
+	case "json":
+		return MarshalJSON(EncodeTree(s))
+	}
+	return nil, fmt.Errorf("unknown settings format %q", format)
+}
+
+// WriteFileAtomic replaces path with content through a temporary file, so a
+// crash never leaves a half written file.
+func WriteFileAtomic(path string, content []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// ConfigCommand runs "config convert", which rewrites the settings file in
+// another format. Environment overrides are not applied, so secrets given as
+// YTPLEX_ variables stay out of the new file. It returns the exit code.
+func ConfigCommand(opts Options, stdout io.Writer, stderr io.Writer) int {
+	if len(opts.Args) == 0 || opts.Args[0] != "convert" {
+		fmt.Fprintln(stderr, "usage: DownloadYouTubePlexGo config convert --to yaml|toml|json|xml [--out path] [--force]")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("config convert", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	to := fs.String("to", "", "format to write: yaml, toml, json or xml")
+	out := fs.String("out", "", "file to write, default the settings file with the new extension")
+	force := fs.Bool("force", false, "replace the output file if it exists")
+	if err := fs.Parse(opts.Args[1:]); err != nil {
+		return 2
+	}
+
+	format := strings.ToLower(*to)
+	if format == "yml" {
+		format = "yaml"
+	}
+	if contains([]string{"yaml", "toml", "json", "xml"}, format) == false {
+		fmt.Fprintln(stderr, "--to must be yaml, toml, json or xml")
+		return 2
+	}
+
+	s, err := ReadSettings(opts.ConfigPath)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	path := *out
+	if path == "" {
+		path = strings.TrimSuffix(opts.ConfigPath, filepath.Ext(opts.ConfigPath)) + "." + format
+	}
+	if outFormat, err := SettingsFormat(path); err != nil || outFormat != format {
+		fmt.Fprintf(stderr, "%s: the file extension does not match --to %s\n", path, format)
+		return 2
+	}
+	if IsValid(path) && *force == false {
+		fmt.Fprintf(stderr, "%s already exists, use --force to replace it\n", path)
+		return 1
+	}
+
+	content, err := MarshalSettings(s, format)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	// The settings hold Pushover tokens
+	if err := WriteFileAtomic(path, content, 0600); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "wrote %s\n", path)
+	return 0
+}
+
+// LoadSettings reads the settings file and applies the environment overrides.
+func LoadSettings(path string) (settings, error) {
+	s, err := ReadSettings(path)
+	if err != nil {
+		return s, err
+	}
+	if err := ApplyEnvOverrides(&s); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// ApplyEnvOverrides replaces global settings with YTPLEX_ environment
+// variables. NAME_FILE wins over NAME, and file contents are trimmed of
+// surrounding whitespace.
+func ApplyEnvOverrides(s *settings) error {
+	v := reflect.ValueOf(s).Elem()
+	for _, name := range settingNames() {
+		env := EnvPrefix + strings.ToUpper(name)
+
+		if fname := os.Getenv(env + "_FILE"); fname != "" {
+			content, err := os.ReadFile(fname)
+			if err != nil {
+				return fmt.Errorf("%s_FILE: %w", env, err)
+			}
+			v.FieldByName(name).SetString(strings.TrimSpace(string(content)))
+			continue
+		}
+
+		if value, ok := os.LookupEnv(env); ok {
+			v.FieldByName(name).SetString(value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ParseJSON parses a JSON settings document into a tree, keeping key order.
+func ParseJSON(content []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.UseNumber()
+
+	tree, err := parseJSONValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected content after the settings object")
+	}
+	return tree, nil
+}
+
+func parseJSONValue(dec *json.Decoder) (any, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := token.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			m := NewOrderedMap()
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := parseJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				m.Set(key.(string), value)
+			}
+			_, err := dec.Token()
+			return m, err
+		case '[':
+			items := []any{}
+			for dec.More() {
+				item, err := parseJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+			_, err := dec.Token()
+			return items, err
+		}
+		return nil, fmt.Errorf("unexpected %v", t)
+
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i, nil
+		}
+		return t.Float64()
+
+	default:
+		// string, bool or nil
+		return t, nil
+	}
+}
+
+// MarshalJSON writes a tree as indented JSON.
+func MarshalJSON(tree any) ([]byte, error) {
+	var b strings.Builder
+	writeJSONValue(&b, tree, 0)
+	b.WriteByte('\n')
+	return []byte(b.String()), nil
+}
+
+func writeJSONValue(b *strings.Builder, value any, indent int) {
+	pad := strings.Repeat("  ", indent)
+
+	switch t := value.(type) {
+	case *OrderedMap:
+		if len(t.Keys) == 0 {
+			b.WriteString("{}")
+			return
+		}
+		b.WriteString("{\n")
+		for i, key := range t.Keys {
+			b.WriteString(pad + "  " + jsonString(key) + ": ")
+			writeJSONValue(b, t.Values[key], indent+1)
+			if i < len(t.Keys)-1 {
+				b.WriteByte(',')
+			}
+			b.WriteByte('\n')
+		}
+		b.WriteString(pad + "}")
+
+	case []any:
+		if len(t) == 0 {
+			b.WriteString("[]")
+			return
+		}
+		b.WriteString("[\n")
+		for i, item := range t {
+			b.WriteString(pad + "  ")
+			writeJSONValue(b, item, indent+1)
+			if i < len(t)-1 {
+				b.WriteByte(',')
+			}
+			b.WriteByte('\n')
+		}
+		b.WriteString(pad + "]")
+
+	case string:
+		b.WriteString(jsonString(t))
+
+	case nil:
+		b.WriteString("null")
+
+	default:
+		b.WriteString(fmt.Sprint(t))
+	}
+}
+
+func jsonString(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
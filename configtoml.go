@@ -0,0 +1,671 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// This is the subset of TOML that settings files need: key/value pairs with
+// bare, quoted and dotted keys, [tables], [[arrays of tables]], all four
+// string forms, integers, floats, booleans, arrays and inline tables. Dates
+// and times are kept as strings. Anything else is an error. Comments are
+// kept in the tree's notes.
+
+type tomlParser struct {
+	s    string
+	pos  int
+	line int
+	// comments are those skipped since they were last taken
+	comments []string
+}
+
+// ParseTOML parses a TOML settings document into a tree.
+func ParseTOML(content []byte) (any, error) {
+	p := &tomlParser{s: strings.ReplaceAll(string(content), "\r\n", "\n"), line: 1}
+	root := NewOrderedMap()
+	current := root
+
+	for {
+		p.skipSpaceAndComments(true)
+		pending := p.takeComments()
+		if p.pos >= len(p.s) {
+			if len(pending) > 0 {
+				root.notes().Trailing = pending
+			}
+			return root, nil
+		}
+
+		if p.s[p.pos] == '[' {
+			array := strings.HasPrefix(p.s[p.pos:], "[[")
+			if array {
+				p.pos += 2
+			} else {
+				p.pos++
+			}
+
+			path, err := p.parseKey()
+			if err != nil {
+				return nil, err
+			}
+
+			closing := "]"
+			if array {
+				closing = "]]"
+			}
+			p.skipSpaceAndComments(false)
+			if strings.HasPrefix(p.s[p.pos:], closing) == false {
+				return nil, p.errorf("expected %s after table name", closing)
+			}
+			p.pos += len(closing)
+
+			if current, err = tomlTable(root, path, array); err != nil {
+				return nil, p.errorf("%v", err)
+			}
+			// A comment after the header moves above it
+			p.skipSpaceAndComments(false)
+			if comments := append(pending, p.takeComments()...); len(comments) > 0 {
+				current.notes().Leading = append(current.notes().Leading, comments...)
+			}
+		} else {
+			path, err := p.parseKey()
+			if err != nil {
+				return nil, err
+			}
+			p.skipSpaceAndComments(false)
+			if p.pos >= len(p.s) || p.s[p.pos] != '=' {
+				return nil, p.errorf("expected = after key")
+			}
+			p.pos++
+			p.skipSpaceAndComments(false)
+
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			if err := tomlSet(current, path, value); err != nil {
+				return nil, p.errorf("%v", err)
+			}
+
+			// Comments inside a multi-line array move above the key
+			before := append(pending, p.takeComments()...)
+			p.skipSpaceAndComments(false)
+			inline := p.takeComments()
+			target, key := current, path[len(path)-1]
+			for _, k := range path[:len(path)-1] {
+				target = target.Values[k].(*OrderedMap)
+			}
+			if len(before) > 0 {
+				target.notes().Before[key] = before
+			}
+			if len(inline) > 0 {
+				target.notes().Inline[key] = inline[0]
+			}
+		}
+
+		p.skipSpaceAndComments(false)
+		if p.pos < len(p.s) && p.s[p.pos] != '\n' {
+			return nil, p.errorf("expected end of line")
+		}
+	}
+}
+
+func (p *tomlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+// skipSpaceAndComments skips spaces, tabs and comments, and newlines too when
+// newlines is set.
+func (p *tomlParser) skipSpaceAndComments(newlines bool) {
+	for p.pos < len(p.s) {
+		switch c := p.s[p.pos]; {
+		case c == ' ' || c == '\t':
+			p.pos++
+		case c == '\n' && newlines:
+			p.pos++
+			p.line++
+		case c == '#':
+			start := p.pos
+			for p.pos < len(p.s) && p.s[p.pos] != '\n' {
+				p.pos++
+			}
+			p.comments = append(p.comments, strings.TrimRight(p.s[start:p.pos], " \t"))
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) takeComments() []string {
+	comments := p.comments
+	p.comments = nil
+	return comments
+}
+
+var (
+	tomlBareKey  = regexp.MustCompile(`^[A-Za-z0-9_-]+`)
+	tomlDate     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	tomlDateTime = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}|^\d{2}:\d{2}`)
+	tomlLineJoin = regexp.MustCompile(`\\\n\s*`)
+	// Underscores may only sit between digits
+	tomlInt   = regexp.MustCompile(`^[+-]?(0|[1-9](_?[0-9])*)$|^0x[0-9a-fA-F](_?[0-9a-fA-F])*$|^0o[0-7](_?[0-7])*$|^0b[01](_?[01])*$`)
+	tomlFloat = regexp.MustCompile(`^[+-]?(0|[1-9](_?[0-9])*)(\.[0-9](_?[0-9])*)?([eE][+-]?[0-9](_?[0-9])*)?$`)
+	tomlInf   = regexp.MustCompile(`^[+-]?(inf|nan)$`)
+)
+
+// parseKey reads a possibly dotted key.
+func (p *tomlParser) parseKey() ([]string, error) {
+	var path []string
+	for {
+		p.skipSpaceAndComments(false)
+		if p.pos >= len(p.s) {
+			return nil, p.errorf("expected a key")
+		}
+
+		switch p.s[p.pos] {
+		case '"', '\'':
+			part, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+			path = append(path, part)
+		default:
+			bare := tomlBareKey.FindString(p.s[p.pos:])
+			if bare == "" {
+				return nil, p.errorf("expected a key")
+			}
+			path = append(path, bare)
+			p.pos += len(bare)
+		}
+
+		p.skipSpaceAndComments(false)
+		if p.pos < len(p.s) && p.s[p.pos] == '.' {
+			p.pos++
+			continue
+		}
+		return path, nil
+	}
+}
+
+func (p *tomlParser) parseValue() (any, error) {
+	if p.pos >= len(p.s) {
+		return nil, p.errorf("expected a value")
+	}
+
+	switch c := p.s[p.pos]; {
+	case c == '"' || c == '\'':
+		return p.parseString()
+	case c == '[':
+		return p.parseArray()
+	case c == '{':
+		return p.parseInlineTable()
+	}
+
+	end := p.pos
+	for end < len(p.s) && strings.IndexByte(" \t\n,]}#", p.s[end]) < 0 {
+		end++
+	}
+	// A date and time may be separated by a space
+	if end+1 < len(p.s) && p.s[end] == ' ' && tomlDate.MatchString(p.s[p.pos:end]) && p.s[end+1] >= '0' && p.s[end+1] <= '9' {
+		end++
+		for end < len(p.s) && strings.IndexByte(" \t\n,]}#", p.s[end]) < 0 {
+			end++
+		}
+	}
+	token := p.s[p.pos:end]
+	p.pos = end
+
+	switch token {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "":
+		return nil, p.errorf("expected a value")
+	}
+
+	number := strings.ReplaceAll(token, "_", "")
+	switch {
+	case tomlInt.MatchString(token):
+		base := 10
+		if strings.HasPrefix(number, "0") && len(number) > 1 {
+			base = 0
+		}
+		i, err := strconv.ParseInt(number, base, 64)
+		if err != nil {
+			return nil, p.errorf("%q is out of range", token)
+		}
+		return i, nil
+	case tomlFloat.MatchString(token), tomlInf.MatchString(token):
+		f, err := strconv.ParseFloat(number, 64)
+		if err != nil {
+			return nil, p.errorf("%q is out of range", token)
+		}
+		return f, nil
+	case tomlDateTime.MatchString(token):
+		return token, nil
+	}
+	return nil, p.errorf("%q is not a TOML value (strings need quotes)", token)
+}
+
+func (p *tomlParser) parseString() (string, error) {
+	switch {
+	case strings.HasPrefix(p.s[p.pos:], `"""`):
+		p.pos += 3
+		end := strings.Index(p.s[p.pos:], `"""`)
+		for end >= 0 && strings.HasSuffix(p.s[p.pos:p.pos+end], `\`) && strings.HasSuffix(p.s[p.pos:p.pos+end], `\\`) == false {
+			next := strings.Index(p.s[p.pos+end+1:], `"""`)
+			if next < 0 {
+				end = -1
+				break
+			}
+			end += next + 1
+		}
+		if end < 0 {
+			return "", p.errorf("unterminated \"\"\" string")
+		}
+		raw := strings.TrimPrefix(p.s[p.pos:p.pos+end], "\n")
+		p.line += strings.Count(p.s[p.pos:p.pos+end], "\n")
+		p.pos += end + 3
+		// A backslash at the end of a line joins it to the next
+		raw = tomlLineJoin.ReplaceAllString(raw, "")
+		return unquoteTOML(raw)
+
+	case strings.HasPrefix(p.s[p.pos:], `'''`):
+		p.pos += 3
+		end := strings.Index(p.s[p.pos:], `'''`)
+		if end < 0 {
+			return "", p.errorf("unterminated ''' string")
+		}
+		raw := strings.TrimPrefix(p.s[p.pos:p.pos+end], "\n")
+		p.line += strings.Count(p.s[p.pos:p.pos+end], "\n")
+		p.pos += end + 3
+		return raw, nil
+
+	case p.s[p.pos] == '\'':
+		end := strings.IndexAny(p.s[p.pos+1:], "'\n")
+		if end < 0 || p.s[p.pos+1+end] != '\'' {
+			return "", p.errorf("unterminated string")
+		}
+		value := p.s[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return value, nil
+
+	default:
+		i := p.pos + 1
+		for i < len(p.s) && p.s[i] != '"' && p.s[i] != '\n' {
+			if p.s[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if i >= len(p.s) || p.s[i] != '"' {
+			return "", p.errorf("unterminated string")
+		}
+		raw := p.s[p.pos+1 : i]
+		p.pos = i + 1
+		value, err := unquoteTOML(raw)
+		if err != nil {
+			return "", p.errorf("%v", err)
+		}
+		return value, nil
+	}
+}
+
+// unquoteTOML resolves the escapes of a basic string, which are a subset of
+// Go's.
+func unquoteTOML(raw string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '\\' {
+			b.WriteByte(raw[i])
+			continue
+		}
+		i++
+		if i >= len(raw) {
+			return "", fmt.Errorf("string ends with a backslash")
+		}
+		switch raw[i] {
+		case 'b':
+			b.WriteByte('\b')
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'f':
+			b.WriteByte('\f')
+		case 'r':
+			b.WriteByte('\r')
+		case 'e':
+			b.WriteByte(0x1b)
+		case '"':
+			b.WriteByte('"')
+		case '\\':
+			b.WriteByte('\\')
+		case 'u', 'U':
+			size := 4
+			if raw[i] == 'U' {
+				size = 8
+			}
+			if i+size >= len(raw) {
+				return "", fmt.Errorf("short \\%c escape", raw[i])
+			}
+			r, err := strconv.ParseUint(raw[i+1:i+1+size], 16, 32)
+			if err != nil {
+				return "", fmt.Errorf("bad \\%c escape", raw[i])
+			}
+			b.WriteRune(rune(r))
+			i += size
+		default:
+			return "", fmt.Errorf("unknown escape \\%c", raw[i])
+		}
+	}
+	return b.String(), nil
+}
+
+func (p *tomlParser) parseArray() (any, error) {
+	p.pos++
+	items := []any{}
+	for {
+		p.skipSpaceAndComments(true)
+		if p.pos >= len(p.s) {
+			return nil, p.errorf("unterminated array")
+		}
+		if p.s[p.pos] == ']' {
+			p.pos++
+			return items, nil
+		}
+
+		item, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+
+		p.skipSpaceAndComments(true)
+		if p.pos < len(p.s) && p.s[p.pos] == ',' {
+			p.pos++
+		} else if p.pos < len(p.s) && p.s[p.pos] != ']' {
+			return nil, p.errorf("expected , or ] in array")
+		}
+	}
+}
+
+func (p *tomlParser) parseInlineTable() (any, error) {
+	p.pos++
+	m := NewOrderedMap()
+	for {
+		p.skipSpaceAndComments(false)
+		if p.pos < len(p.s) && p.s[p.pos] == '}' {
+			p.pos++
+			return m, nil
+		}
+
+		path, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpaceAndComments(false)
+		if p.pos >= len(p.s) || p.s[p.pos] != '=' {
+			return nil, p.errorf("expected = in inline table")
+		}
+		p.pos++
+		p.skipSpaceAndComments(false)
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		if err := tomlSet(m, path, value); err != nil {
+			return nil, p.errorf("%v", err)
+		}
+
+		p.skipSpaceAndComments(false)
+		if p.pos < len(p.s) && p.s[p.pos] == ',' {
+			p.pos++
+		} else if p.pos >= len(p.s) || p.s[p.pos] != '}' {
+			return nil, p.errorf("expected , or } in inline table")
+		}
+	}
+}
+
+// tomlSet sets a dotted key, creating the intermediate tables.
+func tomlSet(m *OrderedMap, path []string, value any) error {
+	for _, key := range path[:len(path)-1] {
+		next, ok := m.Get(key)
+		if ok == false {
+			table := NewOrderedMap()
+			m.Set(key, table)
+			m = table
+			continue
+		}
+		table, ok := next.(*OrderedMap)
+		if ok == false {
+			return fmt.Errorf("key %q is already a value", key)
+		}
+		m = table
+	}
+
+	last := path[len(path)-1]
+	if _, exists := m.Get(last); exists {
+		return fmt.Errorf("duplicate key %q", last)
+	}
+	m.Set(last, value)
+	return nil
+}
+
+// tomlTable finds or creates the table for a [header] or, with array set, adds
+// a new table for an [[header]].
+func tomlTable(root *OrderedMap, path []string, array bool) (*OrderedMap, error) {
+	m := root
+	for i, key := range path {
+		last := i == len(path)-1
+		existing, ok := m.Get(key)
+
+		if last && array {
+			table := NewOrderedMap()
+			if ok == false {
+				m.Set(key, []any{table})
+				return table, nil
+			}
+			items, isArray := existing.([]any)
+			if isArray == false {
+				return nil, fmt.Errorf("%q is not an array of tables", strings.Join(path, "."))
+			}
+			m.Set(key, append(items, table))
+			return table, nil
+		}
+
+		if ok == false {
+			table := NewOrderedMap()
+			m.Set(key, table)
+			m = table
+			continue
+		}
+
+		switch t := existing.(type) {
+		case *OrderedMap:
+			m = t
+		case []any:
+			// [a.b] after [[a]] refers to the last table in a
+			if len(t) == 0 {
+				return nil, fmt.Errorf("%q is not a table", key)
+			}
+			table, isTable := t[len(t)-1].(*OrderedMap)
+			if isTable == false {
+				return nil, fmt.Errorf("%q is not a table", key)
+			}
+			m = table
+		default:
+			return nil, fmt.Errorf("%q is already a value", key)
+		}
+	}
+	return m, nil
+}
+
+// MarshalTOML writes a tree as TOML. The root must be a mapping.
+func MarshalTOML(tree any) ([]byte, error) {
+	root, ok := tree.(*OrderedMap)
+	if ok == false {
+		return nil, fmt.Errorf("TOML documents must be a mapping")
+	}
+
+	var b strings.Builder
+	writeTOMLTable(&b, nil, root)
+	return []byte(strings.TrimLeft(b.String(), "\n")), nil
+}
+
+func isTableArray(value any) bool {
+	items, ok := value.([]any)
+	if ok == false || len(items) == 0 {
+		return false
+	}
+	for _, item := range items {
+		if _, isMap := item.(*OrderedMap); isMap == false {
+			return false
+		}
+	}
+	return true
+}
+
+// writeTOMLTable writes the plain keys of m, then its sub-tables, then its
+// arrays of tables, as TOML requires.
+func writeTOMLTable(b *strings.Builder, path []string, m *OrderedMap) {
+	var notes TreeNotes
+	if m.Notes != nil {
+		notes = *m.Notes
+	}
+
+	for _, key := range m.Keys {
+		value := m.Values[key]
+		if _, isMap := value.(*OrderedMap); isMap || isTableArray(value) || value == nil {
+			continue
+		}
+		writeTOMLComments(b, notes.Before[key])
+		line := tomlKey(key) + " = " + tomlValue(value)
+		if notes.Inline[key] != "" {
+			line += " " + notes.Inline[key]
+		}
+		b.WriteString(line + "\n")
+	}
+
+	for _, key := range m.Keys {
+		table, isMap := m.Values[key].(*OrderedMap)
+		if isMap == false {
+			continue
+		}
+		sub := append(append([]string{}, path...), key)
+		b.WriteString("\n")
+		writeTOMLHeader(b, "["+tomlPath(sub)+"]", notes.Before[key], table)
+		writeTOMLTable(b, sub, table)
+	}
+
+	for _, key := range m.Keys {
+		if isTableArray(m.Values[key]) == false {
+			continue
+		}
+		sub := append(append([]string{}, path...), key)
+		for i, item := range m.Values[key].([]any) {
+			var before []string
+			if i == 0 {
+				before = notes.Before[key]
+			}
+			b.WriteString("\n")
+			writeTOMLHeader(b, "[["+tomlPath(sub)+"]]", before, item.(*OrderedMap))
+			writeTOMLTable(b, sub, item.(*OrderedMap))
+		}
+	}
+	writeTOMLComments(b, notes.Trailing)
+}
+
+// writeTOMLHeader writes a table header with the comments that go before it.
+func writeTOMLHeader(b *strings.Builder, header string, before []string, table *OrderedMap) {
+	writeTOMLComments(b, before)
+	if table.Notes != nil {
+		writeTOMLComments(b, table.Notes.Leading)
+	}
+	b.WriteString(header + "\n")
+}
+
+// writeTOMLComments writes comments kept in the notes, one per line.
+func writeTOMLComments(b *strings.Builder, comments []string) {
+	for _, c := range comments {
+		b.WriteString(c + "\n")
+	}
+}
+
+func tomlPath(path []string) string {
+	keys := make([]string, len(path))
+	for i, key := range path {
+		keys[i] = tomlKey(key)
+	}
+	return strings.Join(keys, ".")
+}
+
+func tomlKey(key string) string {
+	if key != "" && tomlBareKey.FindString(key) == key {
+		return key
+	}
+	return tomlString(key)
+}
+
+func tomlValue(value any) string {
+	switch t := value.(type) {
+	case string:
+		return tomlString(t)
+	case []any:
+		items := make([]string, len(t))
+		for i, item := range t {
+			items[i] = tomlValue(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case *OrderedMap:
+		pairs := make([]string, 0, len(t.Keys))
+		for _, key := range t.Keys {
+			if t.Values[key] != nil {
+				pairs = append(pairs, tomlKey(key)+" = "+tomlValue(t.Values[key]))
+			}
+		}
+		return "{ " + strings.Join(pairs, ", ") + " }"
+	case float64:
+		switch {
+		case math.IsInf(t, 1):
+			return "inf"
+		case math.IsInf(t, -1):
+			return "-inf"
+		case math.IsNaN(t):
+			return "nan"
+		}
+		return formatFloat(t)
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+func tomlString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if r < ' ' || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"empty", "", `{}`},
+		{"pairs", "a = \"x\"\nb = 'y'\n", `{"a": "x", "b": "y"}`},
+		{"comments", "# top\na = \"x\" # after\nb = \"# not a comment\"\n", `{"a": "x", "b": "# not a comment"}`},
+		{"quoted keys", "\"a b\" = 1\n'c' = 2\n", `{"a b": int(1), "c": int(2)}`},
+		{"dotted keys", "a.b = 1\na.c = 2\n", `{"a": {"b": int(1), "c": int(2)}}`},
+		{"tables", "a = 1\n[t]\nb = 2\n[t.u]\nc = 3\n", `{"a": int(1), "t": {"b": int(2), "u": {"c": int(3)}}}`},
+		{"array of tables", "[[p]]\nn = \"x\"\n[[p]]\nn = \"y\"\n[p.q]\nm = 1\n", `{"p": [{"n": "x"}, {"n": "y", "q": {"m": int(1)}}]}`},
+		{"basic escapes", `a = "t\tn\nq\"u\u00e9U\U0001F600e\eb\\"` + "\n", `{"a": "t\tn\nq\"uéU😀e\x1bb\\"}`},
+		{"literal string", `a = 'C:\path'` + "\n", `{"a": "C:\\path"}`},
+		{"multi-line basic", "a = \"\"\"\none \\\n  two\nthree\"\"\"\n", `{"a": "one two\nthree"}`},
+		{"multi-line literal", "a = '''\none\\\ntwo'''\n", `{"a": "one\\\ntwo"}`},
+		{"booleans", "a = true\nb = false\n", `{"a": true, "b": false}`},
+		{"integers", "a = 12\nb = -3\nc = +4\nd = 1_000\ne = 0x1F\nf = 0o17\ng = 0b101\nh = 0\n", `{"a": int(12), "b": int(-3), "c": int(4), "d": int(1000), "e": int(31), "f": int(15), "g": int(5), "h": int(0)}`},
+		{"floats", "a = 1.5\nb = -0.5\nc = 1e3\nd = 6.626e-34\ne = 1_000.5\n", `{"a": float(1.5), "b": float(-0.5), "c": float(1000), "d": float(6.626e-34), "e": float(1000.5)}`},
+		{"special floats", "a = inf\nb = -inf\nc = +inf\nd = nan\n", `{"a": float(+Inf), "b": float(-Inf), "c": float(+Inf), "d": float(nan)}`},
+		{"dates", "a = 1979-05-27\nb = 1979-05-27T07:32:00Z\nc = 1979-05-27 07:32:00\nd = 07:32:00\n", `{"a": "1979-05-27", "b": "1979-05-27T07:32:00Z", "c": "1979-05-27 07:32:00", "d": "07:32:00"}`},
+		{"arrays", "a = [1, \"x\", [true]]\nb = [\n  1,\n  2, # two\n]\nc = []\n", `{"a": [int(1), "x", [true]], "b": [int(1), int(2)], "c": []}`},
+		{"inline table", "a = { b = 1, c.d = \"x\" }\ne = {}\n", `{"a": {"b": int(1), "c": {"d": "x"}}, "e": {}}`},
+		{"crlf", "a = 1\r\nb = 2\r\n", `{"a": int(1), "b": int(2)}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := ParseTOML([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("ParseTOML(%q) failed: %v", tt.in, err)
+			}
+			if got := dumpTree(tree); got != tt.want {
+				t.Errorf("ParseTOML(%q)\n got %s\nwant %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"bare string", "a = x\n", "strings need quotes"},
+		{"leading zero", "a = 012\n", "not a TOML value"},
+		{"double underscore", "a = 1__0\n", "not a TOML value"},
+		{"trailing underscore", "a = 10_\n", "not a TOML value"},
+		{"signed hex", "a = +0x10\n", "not a TOML value"},
+		{"Go infinity", "a = Inf\n", "not a TOML value"},
+		{"infinity", "a = infinity\n", "not a TOML value"},
+		{"hex float", "a = 0x1p3\n", "not a TOML value"},
+		{"bare dot float", "a = .5\n", "not a TOML value"},
+		{"trailing dot float", "a = 5.\n", "not a TOML value"},
+		{"out of range", "a = 9223372036854775808\n", "out of range"},
+		{"duplicate key", "a = 1\na = 2\n", "duplicate key"},
+		{"key reused as table", "a = 1\n[a]\n", "already a value"},
+		{"missing =", "a 1\n", "expected = after key"},
+		{"two values on a line", "a = 1 b = 2\n", "expected end of line"},
+		{"unterminated string", "a = \"x\n", "unterminated string"},
+		{"unterminated literal", "a = 'x\n", "unterminated string"},
+		{"unterminated multi-line", "a = \"\"\"x\n", "unterminated"},
+		{"unknown escape", `a = "\q"` + "\n", "unknown escape"},
+		{"unterminated array", "a = [1, 2\n", "unterminated array"},
+		{"array without commas", "a = [1 2]\n", "expected , or ]"},
+		{"multi-line inline table", "a = {\n b = 1 }\n", "expected a key"},
+		{"unclosed table", "[a\nb = 1\n", "expected ] after table name"},
+		{"table array over table", "[a]\n[[a]]\n", "not an array of tables"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := ParseTOML([]byte(tt.in))
+			if err == nil {
+				t.Fatalf("ParseTOML(%q) = %s, want an error containing %q", tt.in, dumpTree(tree), tt.want)
+			}
+			if strings.Contains(err.Error(), tt.want) == false {
+				t.Errorf("ParseTOML(%q) error = %q, want it to contain %q", tt.in, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshalTOMLRoundTrip(t *testing.T) {
+	tests := []string{
+		"a = \"x\"\nb = [1, true, \"y\"]\n[t]\nc = 1.5\n",
+		"a = inf\nb = -inf\nc = nan\nd = 2.0\ne = 1e300\n",
+		"\"odd key\" = \"q\\\"uote\\\\ \\t tab\\n\"\n[[p]]\nn = 1\n[p.q]\nm = { x = 1 }\n[[p]]\nn = 2\n",
+	}
+	for _, in := range tests {
+		tree, err := ParseTOML([]byte(in))
+		if err != nil {
+			t.Fatalf("ParseTOML(%q) failed: %v", in, err)
+		}
+		out, err := MarshalTOML(tree)
+		if err != nil {
+			t.Fatalf("MarshalTOML failed: %v", err)
+		}
+		back, err := ParseTOML(out)
+		if err != nil {
+			t.Fatalf("MarshalTOML output does not parse: %v\n%s", err, out)
+		}
+		if dumpTree(back) != dumpTree(tree) {
+			t.Errorf("round trip of %q\n got %s\nwant %s\nvia\n%s", in, dumpTree(back), dumpTree(tree), out)
+		}
+	}
+}
+
+func TestMarshalTOMLKeepsComments(t *testing.T) {
+	in := `# Global settings
+Config = "/config/" # state lives here
+
+# Defaults for every channel
+[Defaults]
+FileFormat = "mkv"
+
+# The first one
+[[PodcastDownload]]
+Name = "One"
+# Pinned
+ChannelID = "UCrrrrrrrrrrrrrrrrrrrrrr"
+Notes = "# not a comment" # but this is
+
+# [[PodcastDownload]]
+# Name = "Commented out"
+[[PodcastDownload]]
+Name = "Two"
+# the end
+`
+	tree, err := ParseTOML([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := MarshalTOML(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != in {
+		t.Errorf("rewritten file differs\n got:\n%s\nwant:\n%s", out, in)
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// The YAML, TOML and JSON settings formats are all parsed into the same
+// document tree, then decoded into the settings structs by field name. The
+// tree keeps key order so a rewritten file looks like the original.
+//
+// Tree values are *OrderedMap, []any, string, bool, int64, float64 or nil.
+
+// OrderedMap is a mapping that remembers the order keys were added in.
+type OrderedMap struct {
+	Keys   []string
+	Values map[string]any
+	// Notes keeps the comments and such of a mapping read from a file
+	Notes *TreeNotes
+}
+
+// TreeNotes is what a settings file holds besides keys and values, kept on
+// the mapping it was found in so a rewrite keeps it. Comments are kept as
+// written, <!-- --> or #, and only go back into a file of the same format.
+type TreeNotes struct {
+	// Root is the root element's name; Prolog the declaration and comments
+	// before it and Epilog the comments after it. Only an XML root has them.
+	Root   string
+	Prolog []string
+	Epilog []string
+	// Leading are the comments before this mapping, Trailing those after
+	// its last key
+	Leading  []string
+	Trailing []string
+	// Before are the comments before a key, Inline one at the end of its
+	// line, and Inner those inside an XML text element, by key
+	Before map[string][]string
+	Inline map[string]string
+	Inner  map[string][]string
+}
+
+// notes returns the mapping's notes, adding them if need be.
+func (m *OrderedMap) notes() *TreeNotes {
+	if m.Notes == nil {
+		m.Notes = &TreeNotes{Before: map[string][]string{}, Inline: map[string]string{}, Inner: map[string][]string{}}
+	}
+	return m.Notes
+}
+
+func NewOrderedMap() *OrderedMap {
+	return &OrderedMap{Values: map[string]any{}}
+}
+
+func (m *OrderedMap) Set(key string, value any) {
+	if _, ok := m.Values[key]; ok == false {
+		m.Keys = append(m.Keys, key)
+	}
+	m.Values[key] = value
+}
+
+func (m *OrderedMap) Get(key string) (any, bool) {
+	value, ok := m.Values[key]
+	return value, ok
+}
+
+// Lookup finds key ignoring case, returning the key as written in the file.
+func (m *OrderedMap) Lookup(key string) (string, any, bool) {
+	if value, ok := m.Values[key]; ok {
+		return key, value, true
+	}
+	for _, k := range m.Keys {
+		if strings.EqualFold(k, key) {
+			return k, m.Values[k], true
+		}
+	}
+	return "", nil, false
+}
+
+func (m *OrderedMap) Delete(key string) {
+	if _, ok := m.Values[key]; ok == false {
+		return
+	}
+	delete(m.Values, key)
+	for i, k := range m.Keys {
+		if k == key {
+			m.Keys = append(m.Keys[:i], m.Keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// fieldKey is the name a struct field has in the settings files: its xml tag
+// name, or the field name.
+func fieldKey(f reflect.StructField) string {
+	tag := strings.Split(f.Tag.Get("xml"), ",")[0]
+	if tag != "" && tag != "-" {
+		return tag
+	}
+	return f.Name
+}
+
+// settingsFields lists the exported fields of a settings struct that are
+// stored in the settings files.
+func settingsFields(t reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.IsExported() == false || f.Tag.Get("xml") == "-" || strings.Contains(f.Tag.Get("xml"), ",any") {
+			continue
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// DecodeTree fills the struct pointed to by out from a document tree. Keys
+// are matched to fields ignoring case and unknown keys are ignored.
+func DecodeTree(tree any, out any) error {
+	return decodeValue(tree, reflect.ValueOf(out).Elem(), "")
+}
+
+func decodeValue(node any, v reflect.Value, path string) error {
+	if node == nil {
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		switch n := node.(type) {
+		case string:
+			v.SetString(n)
+		case bool, int64, float64:
+			v.SetString(fmt.Sprint(n))
+		default:
+			return fmt.Errorf("%s: expected a value, found %s", path, treeKind(node))
+		}
+
+	case reflect.Bool:
+		switch n := node.(type) {
+		case bool:
+			v.SetBool(n)
+		case string:
+			b, err := strconv.ParseBool(n)
+			if err != nil {
+				return fmt.Errorf("%s: %q is not true or false", path, n)
+			}
+			v.SetBool(b)
+		default:
+			return fmt.Errorf("%s: expected true or false, found %s", path, treeKind(node))
+		}
+
+	case reflect.Int, reflect.Int64:
+		switch n := node.(type) {
+		case int64:
+			v.SetInt(n)
+		case string:
+			i, err := strconv.ParseInt(n, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%s: %q is not a whole number", path, n)
+			}
+			v.SetInt(i)
+		default:
+			return fmt.Errorf("%s: expected a whole number, found %s", path, treeKind(node))
+		}
+
+	case reflect.Slice:
+		items, ok := node.([]any)
+		if ok == false {
+			// A single value where a list is expected, as XML allows
+			items = []any{node}
+		}
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := decodeValue(item, slice.Index(i), path+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decodeValue(node, v.Elem(), path)
+
+	case reflect.Struct:
+		m, ok := node.(*OrderedMap)
+		if ok == false {
+			return fmt.Errorf("%s: expected a mapping, found %s", path, treeKind(node))
+		}
+		for _, f := range settingsFields(v.Type()) {
+			_, value, found := m.Lookup(fieldKey(f))
+			if found == false {
+				continue
+			}
+			fieldPath := fieldKey(f)
+			if path != "" {
+				fieldPath = path + "." + fieldPath
+			}
+			if err := decodeValue(value, v.FieldByIndex(f.Index), fieldPath); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("%s: unsupported setting type %s", path, v.Type())
+	}
+	return nil
+}
+
+func treeKind(node any) string {
+	switch node.(type) {
+	case *OrderedMap:
+		return "a mapping"
+	case []any:
+		return "a list"
+	default:
+		return "a value"
+	}
+}
+
+// EncodeTree turns a settings struct into a document tree, leaving out empty
+// values so converted files only hold what was set.
+func EncodeTree(in any) any {
+	return encodeValue(reflect.ValueOf(in))
+}
+
+func encodeValue(v reflect.Value) any {
+	switch v.Kind() {
+	case reflect.String:
+		return typedScalar(v.String())
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int64:
+		return v.Int()
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return encodeValue(v.Elem())
+	case reflect.Slice:
+		items := make([]any, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			items = append(items, encodeValue(v.Index(i)))
+		}
+		return items
+	case reflect.Struct:
+		m := NewOrderedMap()
+		for _, f := range settingsFields(v.Type()) {
+			field := v.FieldByIndex(f.Index)
+			if field.IsZero() {
+				continue
+			}
+			m.Set(fieldKey(f), encodeValue(field))
+		}
+		return m
+	}
+	return nil
+}
+
+// typedScalar turns a setting the structs keep as a string, such as
+// ChannelWorkers, back into the number or boolean it holds, so a converted
+// file does not quote it. Only values that read back the same are turned.
+func typedScalar(s string) any {
+	switch s {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil && strconv.FormatInt(i, 10) == s {
+		return i
+	}
+	return s
+}
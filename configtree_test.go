@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// dumpTree writes a document tree on one line with the type of every value,
+// so tests can compare trees as strings.
+func dumpTree(node any) string {
+	switch t := node.(type) {
+	case *OrderedMap:
+		parts := make([]string, len(t.Keys))
+		for i, key := range t.Keys {
+			parts[i] = strconv.Quote(key) + ": " + dumpTree(t.Values[key])
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	case []any:
+		parts := make([]string, len(t))
+		for i, item := range t {
+			parts[i] = dumpTree(item)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case string:
+		return strconv.Quote(t)
+	case int64:
+		return fmt.Sprintf("int(%d)", t)
+	case float64:
+		if math.IsNaN(t) {
+			return "float(nan)"
+		}
+		return fmt.Sprintf("float(%v)", t)
+	case bool:
+		return fmt.Sprint(t)
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("unexpected %T", node)
+}
+
+func TestEncodeTreeTypes(t *testing.T) {
+	s := settings{ChannelWorkers: "2", PlaylistItems: "1-5", PushoverUserToken: "0123", TimeZone: "UTC"}
+	s.Defaults.SkipShorts = "true"
+
+	got := dumpTree(EncodeTree(s))
+	for _, want := range []string{`"ChannelWorkers": int(2)`, `"PlaylistItems": "1-5"`, `"PushoverUserToken": "0123"`, `"SkipShorts": true`} {
+		if strings.Contains(got, want) == false {
+			t.Errorf("EncodeTree = %s, want it to contain %s", got, want)
+		}
+	}
+
+	for _, format := range []string{"yaml", "toml", "json"} {
+		content, err := MarshalSettings(s, format)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if strings.Contains(string(content), `"2"`) || strings.Contains(string(content), `"true"`) {
+			t.Errorf("%s quotes a number or boolean:\n%s", format, content)
+		}
+
+		tree, err := parseSettingsTree(format, content)
+		if err != nil {
+			t.Fatalf("%s does not parse: %v\n%s", format, err, content)
+		}
+		var back settings
+		if err := DecodeTree(tree, &back); err != nil {
+			t.Fatalf("%s does not load: %v", format, err)
+		}
+		if back.ChannelWorkers != "2" || back.PushoverUserToken != "0123" || back.Defaults.SkipShorts != "true" {
+			t.Errorf("%s round trip = %+v", format, back)
+		}
+	}
+}
+
+func TestMarshalSettingsXMLLeavesOutEmpty(t *testing.T) {
+	s := settings{Config: "/config/", PlaylistItems: "1-5", QuietHours: []QuietHours{{Start: "22:00", End: "07:00"}}}
+	s.Defaults.FileFormat = "mkv"
+	s.PodcastDownload = []YouTubeDownload{{Name: "Chan", ChannelID: "UCrrrrrrrrrrrrrrrrrrrrrr", Disabled: true}, {Name: "Other"}}
+
+	content, err := MarshalSettings(s, "xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, empty := range []string{"<FailureAlertWindow>", "<MediaFolder>", "<Disabled>false</Disabled>", "<Cookies>"} {
+		if strings.Contains(string(content), empty) {
+			t.Errorf("empty setting %s written:\n%s", empty, content)
+		}
+	}
+
+	var back settings
+	if err := xml.Unmarshal(content, &back); err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(back, s) == false {
+		t.Errorf("settings read back = %+v, want %+v", back, s)
+	}
+}
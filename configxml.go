@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ParseXML parses a settings.xml into a document tree so it can be edited
+// without losing elements the settings structs do not know about. An element
+// holding only text becomes a string, one with child elements a mapping, and
+// repeated child elements a list. The root element's name, the XML
+// declaration and comments are kept in each mapping's notes so a rewrite
+// puts them back; attributes are not kept.
+func ParseXML(content []byte) (any, error) {
+	dec := xml.NewDecoder(bytes.NewReader(content))
+	var prolog []string
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no root element")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			root, _, err := parseXMLElement(dec, start)
+			if err != nil {
+				return nil, err
+			}
+			if m, ok := root.(*OrderedMap); ok {
+				m.notes().Root = start.Name.Local
+				m.notes().Prolog = prolog
+				m.notes().Epilog = xmlEpilog(dec)
+			}
+			return root, nil
+		}
+		if raw := rawXMLToken(token); raw != "" {
+			prolog = append(prolog, raw)
+		}
+	}
+}
+
+// rawXMLToken writes a comment, processing instruction or directive back as
+// it appeared, and anything else as "".
+func rawXMLToken(token xml.Token) string {
+	switch t := token.(type) {
+	case xml.Comment:
+		return "<!--" + string(t) + "-->"
+	case xml.ProcInst:
+		if len(t.Inst) == 0 {
+			return "<?" + t.Target + "?>"
+		}
+		return "<?" + t.Target + " " + string(t.Inst) + "?>"
+	case xml.Directive:
+		return "<!" + string(t) + ">"
+	}
+	return ""
+}
+
+// xmlEpilog collects the comments after the root element.
+func xmlEpilog(dec *xml.Decoder) []string {
+	var epilog []string
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return epilog
+		}
+		if raw := rawXMLToken(token); raw != "" {
+			epilog = append(epilog, raw)
+		}
+	}
+}
+
+// parseXMLElement parses the element start opened. For a text element it
+// also returns the comments inside it.
+func parseXMLElement(dec *xml.Decoder, start xml.StartElement) (any, []string, error) {
+	var text strings.Builder
+	var m *OrderedMap
+	// Comments wait here for the element they come before
+	var pending []string
+	before := map[string][]string{}
+	inner := map[string][]string{}
+
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, nil, fmt.Errorf("<%s>: %w", start.Name.Local, err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			child, comments, err := parseXMLElement(dec, t)
+			if err != nil {
+				return nil, nil, err
+			}
+			name := t.Name.Local
+			if c, ok := child.(*OrderedMap); ok {
+				c.notes().Leading = pending
+			} else {
+				before[name] = append(before[name], pending...)
+				inner[name] = append(inner[name], comments...)
+			}
+			pending = nil
+
+			if m == nil {
+				m = NewOrderedMap()
+			}
+			switch existing, found := m.Get(name); {
+			case found == false:
+				m.Set(name, child)
+			case isXMLList(existing):
+				m.Set(name, append(existing.([]any), child))
+			default:
+				m.Set(name, []any{existing, child})
+			}
+
+		case xml.CharData:
+			text.Write(t)
+
+		case xml.Comment:
+			pending = append(pending, rawXMLToken(t))
+
+		case xml.EndElement:
+			if m != nil {
+				notes := m.notes()
+				notes.Trailing = pending
+				notes.Before = before
+				notes.Inner = inner
+				return m, nil, nil
+			}
+			return strings.TrimSpace(text.String()), pending, nil
+		}
+	}
+}
+
+// isXMLList tells a list built from repeated elements apart from a value.
+func isXMLList(value any) bool {
+	_, ok := value.([]any)
+	return ok
+}
+
+// MarshalXML writes a tree as an indented XML document. The root element is
+// the one the tree was parsed from, else root.
+func MarshalXML(tree any, root string) ([]byte, error) {
+	m, ok := tree.(*OrderedMap)
+	if ok == false {
+		return nil, fmt.Errorf("XML documents must be a mapping")
+	}
+
+	var notes TreeNotes
+	if m.Notes != nil {
+		notes = *m.Notes
+	}
+	if notes.Root != "" {
+		root = notes.Root
+	}
+
+	var b strings.Builder
+	writeXMLComments(&b, notes.Prolog, 0)
+	b.WriteString("<" + root + ">\n")
+	writeXMLMap(&b, m, 1)
+	b.WriteString("</" + root + ">\n")
+	writeXMLComments(&b, notes.Epilog, 0)
+	return []byte(b.String()), nil
+}
+
+// writeXMLComments writes comments kept in TreeNotes, one per line.
+func writeXMLComments(b *strings.Builder, comments []string, indent int) {
+	pad := strings.Repeat("  ", indent)
+	for _, c := range comments {
+		b.WriteString(pad + c + "\n")
+	}
+}
+
+func writeXMLMap(b *strings.Builder, m *OrderedMap, indent int) {
+	var notes TreeNotes
+	if m.Notes != nil {
+		notes = *m.Notes
+	}
+
+	for _, key := range m.Keys {
+		writeXMLComments(b, notes.Before[key], indent)
+		if items, ok := m.Values[key].([]any); ok {
+			for _, item := range items {
+				writeXMLElement(b, key, item, notes.Inner[key], indent)
+			}
+			continue
+		}
+		writeXMLElement(b, key, m.Values[key], notes.Inner[key], indent)
+	}
+	writeXMLComments(b, notes.Trailing, indent)
+}
+
+func writeXMLElement(b *strings.Builder, name string, value any, inner []string, indent int) {
+	pad := strings.Repeat("  ", indent)
+
+	switch t := value.(type) {
+	case *OrderedMap:
+		if t.Notes != nil {
+			writeXMLComments(b, t.Notes.Leading, indent)
+		}
+		b.WriteString(pad + "<" + name + ">\n")
+		writeXMLMap(b, t, indent+1)
+		b.WriteString(pad + "</" + name + ">\n")
+	case nil:
+		b.WriteString(pad + "<" + name + ">" + strings.Join(inner, "") + "</" + name + ">\n")
+	default:
+		var escaped bytes.Buffer
+		xml.EscapeText(&escaped, []byte(fmt.Sprint(t)))
+		b.WriteString(pad + "<" + name + ">" + strings.Join(inner, "") + escaped.String() + "</" + name + ">\n")
+	}
+}
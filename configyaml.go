@@ -0,0 +1,731 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// This is the subset of YAML that settings files need: block mappings and
+// sequences, plain and quoted scalars on one line, | and > block scalars
+// without indentation indicators, simple flow [lists] and {mappings}, and
+// comments, which are kept in the tree's notes. Anchors, aliases, tags, directives, complex keys and
+// multi-document files are not supported and are errors rather than being
+// misread.
+
+// The YAML 1.2 core schema's numbers
+var (
+	yamlInt   = regexp.MustCompile(`^[-+]?[0-9]+$|^0o[0-7]+$|^0x[0-9a-fA-F]+$`)
+	yamlFloat = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+	yamlInf   = regexp.MustCompile(`^[-+]?\.(inf|Inf|INF)$`)
+	yamlNaN   = regexp.MustCompile(`^\.(nan|NaN|NAN)$`)
+)
+
+type yamlLine struct {
+	num     int
+	indent  int
+	text    string // without indentation and comments; empty for blank lines
+	comment string // the # comment on the line, if any
+	raw     string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+	// pending are comment lines waiting for the key or item they come before
+	pending []string
+}
+
+// ParseYAML parses a YAML settings document into a tree.
+func ParseYAML(content []byte) (any, error) {
+	p := &yamlParser{}
+	// The newline ending the last line does not start another
+	text := strings.TrimSuffix(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n")
+	for i, raw := range strings.Split(text, "\n") {
+		trimmed := strings.TrimLeft(raw, " ")
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: tabs cannot be used for indentation", i+1)
+		}
+		stripped := stripYAMLComment(trimmed)
+		text := strings.TrimSpace(stripped)
+		comment := strings.TrimSpace(trimmed[len(stripped):])
+		if i == 0 && text == "---" {
+			// Kept like a comment so a rewrite starts the same way
+			text, comment = "", strings.TrimSpace(raw)
+		}
+		switch {
+		case i > 0 && (raw == "---" || strings.HasPrefix(raw, "--- ")), raw == "..." || strings.HasPrefix(raw, "... "):
+			return nil, fmt.Errorf("line %d: multi-document files are not supported", i+1)
+		case strings.HasPrefix(raw, "%"):
+			return nil, fmt.Errorf("line %d: directives are not supported", i+1)
+		case text == "?" || strings.HasPrefix(text, "? "):
+			return nil, fmt.Errorf("line %d: complex keys are not supported", i+1)
+		}
+		p.lines = append(p.lines, yamlLine{num: i + 1, indent: len(raw) - len(trimmed), text: text, comment: comment, raw: raw})
+	}
+
+	p.skipBlank()
+	if p.pos >= len(p.lines) {
+		m := NewOrderedMap()
+		if len(p.pending) > 0 {
+			m.notes().Trailing = p.takeComments()
+		}
+		return m, nil
+	}
+
+	tree, err := p.parseBlock(p.lines[p.pos].indent)
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipBlank()
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation or content", p.lines[p.pos].num)
+	}
+	if m, ok := tree.(*OrderedMap); ok && len(p.pending) > 0 {
+		m.notes().Trailing = p.takeComments()
+	}
+	return tree, nil
+}
+
+// stripYAMLComment removes a # comment that is not inside quotes.
+func stripYAMLComment(s string) string {
+	quote := byte(0)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || s[i-1] == ' ' || s[i-1] == '[' || s[i-1] == '{' || s[i-1] == ',' || s[i-1] == ':' || s[i-1] == '-' {
+				quote = c
+			}
+		case c == '#':
+			if i == 0 || s[i-1] == ' ' {
+				return s[:i]
+			}
+		}
+	}
+	return s
+}
+
+// skipBlank moves past blank and comment lines, keeping them, blank lines
+// as "", for whatever follows.
+func (p *yamlParser) skipBlank() {
+	for p.pos < len(p.lines) && p.lines[p.pos].text == "" {
+		p.pending = append(p.pending, p.lines[p.pos].comment)
+		p.pos++
+	}
+}
+
+func (p *yamlParser) takeComments() []string {
+	comments := p.pending
+	p.pending = nil
+	return comments
+}
+
+func isYAMLSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYAMLKey splits "key: value" outside quotes and flow collections.
+func splitYAMLKey(text string) (string, string, bool) {
+	if text == "" || strings.ContainsRune("[{", rune(text[0])) {
+		return "", "", false
+	}
+
+	start := 0
+	if text[0] == '"' || text[0] == '\'' {
+		end := strings.IndexByte(text[1:], text[0])
+		if end < 0 {
+			return "", "", false
+		}
+		start = end + 2
+	}
+
+	for i := start; i < len(text); i++ {
+		if text[i] == ':' && (i == len(text)-1 || text[i+1] == ' ') {
+			key := strings.TrimSpace(text[:i])
+			if key != "" && (key[0] == '"' || key[0] == '\'') {
+				unquoted, err := parseYAMLScalar(key)
+				if err != nil {
+					return "", "", false
+				}
+				key = fmt.Sprint(unquoted)
+			}
+			return key, strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+func (p *yamlParser) parseBlock(indent int) (any, error) {
+	line := p.lines[p.pos]
+	if isYAMLSequenceItem(line.text) {
+		return p.parseSequence(indent)
+	}
+	if _, _, ok := splitYAMLKey(line.text); ok {
+		return p.parseMapping(indent)
+	}
+
+	p.pos++
+	return parseYAMLScalar(line.text)
+}
+
+func (p *yamlParser) parseSequence(indent int) (any, error) {
+	items := []any{}
+	for {
+		p.skipBlank()
+		if p.pos >= len(p.lines) {
+			break
+		}
+		line := p.lines[p.pos]
+		if line.indent != indent || isYAMLSequenceItem(line.text) == false {
+			break
+		}
+
+		rest := strings.TrimSpace(line.text[1:])
+		if rest == "" {
+			p.pos++
+			p.skipBlank()
+			if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+				item, err := p.parseBlock(p.lines[p.pos].indent)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			} else {
+				items = append(items, nil)
+			}
+			continue
+		}
+
+		// The item's content continues at the column after "- "
+		contentIndent := indent + len(line.text) - len(rest)
+		_, _, isMapping := splitYAMLKey(rest)
+		if isYAMLSequenceItem(rest) || isMapping {
+			// Comments before the dash belong to the item, not its first key
+			leading := p.takeComments()
+			p.lines[p.pos] = yamlLine{num: line.num, indent: contentIndent, text: rest, comment: line.comment, raw: line.raw}
+			item, err := p.parseBlock(contentIndent)
+			if err != nil {
+				return nil, err
+			}
+			if m, ok := item.(*OrderedMap); ok && len(leading) > 0 {
+				m.notes().Leading = leading
+			} else if len(leading) > 0 {
+				p.pending = append(leading, p.pending...)
+			}
+			items = append(items, item)
+			continue
+		}
+
+		if isYAMLBlockScalar(rest) {
+			item, err := p.parseBlockScalar(rest, indent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			continue
+		}
+
+		item, err := parseYAMLScalar(rest)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line.num, err)
+		}
+		items = append(items, item)
+		p.pos++
+	}
+	return items, nil
+}
+
+func (p *yamlParser) parseMapping(indent int) (any, error) {
+	m := NewOrderedMap()
+	for {
+		p.skipBlank()
+		if p.pos >= len(p.lines) {
+			break
+		}
+		line := p.lines[p.pos]
+		if line.indent < indent || (line.indent == indent && isYAMLSequenceItem(line.text)) {
+			break
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", line.num)
+		}
+
+		if err := checkYAMLPlain(line.text); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line.num, err)
+		}
+		key, rest, ok := splitYAMLKey(line.text)
+		if ok == false {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", line.num)
+		}
+		if _, exists := m.Get(key); exists {
+			return nil, fmt.Errorf("line %d: duplicate key %q", line.num, key)
+		}
+		if len(p.pending) > 0 {
+			m.notes().Before[key] = p.takeComments()
+		}
+		if line.comment != "" {
+			m.notes().Inline[key] = line.comment
+		}
+
+		switch {
+		case rest == "":
+			p.pos++
+			p.skipBlank()
+			var value any
+			if p.pos < len(p.lines) {
+				next := p.lines[p.pos]
+				if next.indent > indent || (next.indent == indent && isYAMLSequenceItem(next.text)) {
+					v, err := p.parseBlock(next.indent)
+					if err != nil {
+						return nil, err
+					}
+					value = v
+				}
+			}
+			m.Set(key, value)
+
+		case isYAMLBlockScalar(rest):
+			value, err := p.parseBlockScalar(rest, indent)
+			if err != nil {
+				return nil, err
+			}
+			m.Set(key, value)
+
+		default:
+			value, err := parseYAMLScalar(rest)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line.num, err)
+			}
+			m.Set(key, value)
+			p.pos++
+		}
+	}
+	return m, nil
+}
+
+func isYAMLBlockScalar(text string) bool {
+	switch text {
+	case "|", "|-", "|+", ">", ">-", ">+":
+		return true
+	}
+	return false
+}
+
+// checkYAMLPlain refuses plain scalars that start with an indicator this
+// parser does not support, which YAML would read as something else.
+func checkYAMLPlain(text string) error {
+	switch text[0] {
+	case '&':
+		return fmt.Errorf("anchors are not supported: %s", text)
+	case '*':
+		return fmt.Errorf("aliases are not supported: %s", text)
+	case '!':
+		return fmt.Errorf("tags are not supported: %s", text)
+	case '|', '>':
+		return fmt.Errorf("block scalar indicator %s is not supported; use |, |-, |+, >, >- or >+", text)
+	case '@', '`', '%':
+		return fmt.Errorf("a plain value cannot start with %c: %s", text[0], text)
+	}
+	return nil
+}
+
+// parseBlockScalar reads the indented lines after a | or > indicator on the
+// current line. parentIndent is the indentation of the key or item.
+func (p *yamlParser) parseBlockScalar(indicator string, parentIndent int) (any, error) {
+	p.pos++
+
+	var lines []string
+	blockIndent := -1
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if strings.TrimSpace(line.raw) == "" {
+			lines = append(lines, "")
+			p.pos++
+			continue
+		}
+		if line.indent <= parentIndent {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = line.indent
+		}
+		if line.indent < blockIndent {
+			return nil, fmt.Errorf("line %d: block scalar is less indented than its first line", line.num)
+		}
+		lines = append(lines, line.raw[blockIndent:])
+		p.pos++
+	}
+
+	// Trailing blank lines belong to chomping, not the content
+	trailing := 0
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		trailing++
+	}
+
+	var text string
+	if indicator[0] == '|' {
+		text = strings.Join(lines, "\n")
+	} else {
+		var b strings.Builder
+		for i, line := range lines {
+			// A blank line is a line break; a line break alone is a space
+			switch {
+			case line == "":
+				b.WriteString("\n")
+			case i == 0 || lines[i-1] == "":
+			default:
+				b.WriteString(" ")
+			}
+			b.WriteString(line)
+		}
+		text = b.String()
+	}
+
+	switch {
+	case strings.HasSuffix(indicator, "-"):
+	case strings.HasSuffix(indicator, "+"):
+		text += strings.Repeat("\n", trailing+1)
+	default:
+		text += "\n"
+	}
+	return text, nil
+}
+
+// parseYAMLScalar parses a single-line value: a quoted or plain scalar or a
+// flow collection.
+func parseYAMLScalar(text string) (any, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, nil
+	}
+
+	switch text[0] {
+	case '"':
+		if len(text) < 2 || text[len(text)-1] != '"' {
+			return nil, fmt.Errorf("unterminated string %s", text)
+		}
+		return unquoteYAML(text[1 : len(text)-1])
+
+	case '\'':
+		if len(text) < 2 || text[len(text)-1] != '\'' {
+			return nil, fmt.Errorf("unterminated string %s", text)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+
+	case '[':
+		if text[len(text)-1] != ']' {
+			return nil, fmt.Errorf("unterminated list %s", text)
+		}
+		items := []any{}
+		for _, part := range splitFlow(text[1 : len(text)-1]) {
+			item, err := parseYAMLScalar(part)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+
+	case '{':
+		if text[len(text)-1] != '}' {
+			return nil, fmt.Errorf("unterminated mapping %s", text)
+		}
+		m := NewOrderedMap()
+		for _, part := range splitFlow(text[1 : len(text)-1]) {
+			key, rest, ok := splitYAMLKey(part)
+			if ok == false {
+				return nil, fmt.Errorf("expected \"key: value\" in %s", text)
+			}
+			value, err := parseYAMLScalar(rest)
+			if err != nil {
+				return nil, err
+			}
+			m.Set(key, value)
+		}
+		return m, nil
+	}
+
+	if err := checkYAMLPlain(text); err != nil {
+		return nil, err
+	}
+	return parsePlainYAML(text), nil
+}
+
+// yamlEscapes are the single character escapes of double quoted strings.
+var yamlEscapes = map[byte]string{
+	'0': "\x00", 'a': "\a", 'b': "\b", 't': "\t", '\t': "\t", 'n': "\n", 'v': "\v", 'f': "\f", 'r': "\r",
+	'e': "\x1b", ' ': " ", '"': "\"", '/': "/", '\\': "\\", 'N': "\u0085", '_': "\u00a0", 'L': "\u2028", 'P': "\u2029",
+}
+
+// unquoteYAML resolves the escapes of a double quoted string, given without
+// its quotes.
+func unquoteYAML(raw string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(raw); i++ {
+		switch raw[i] {
+		case '"':
+			return "", fmt.Errorf("unescaped \" inside a double quoted string")
+		case '\\':
+		default:
+			b.WriteByte(raw[i])
+			continue
+		}
+
+		i++
+		if i >= len(raw) {
+			return "", fmt.Errorf("string ends with a backslash")
+		}
+		if escaped, ok := yamlEscapes[raw[i]]; ok {
+			b.WriteString(escaped)
+			continue
+		}
+		size := map[byte]int{'x': 2, 'u': 4, 'U': 8}[raw[i]]
+		if size == 0 {
+			return "", fmt.Errorf("unknown escape \\%c", raw[i])
+		}
+		if i+size >= len(raw) {
+			return "", fmt.Errorf("short \\%c escape", raw[i])
+		}
+		r, err := strconv.ParseUint(raw[i+1:i+1+size], 16, 32)
+		if err != nil || utf8.ValidRune(rune(r)) == false {
+			return "", fmt.Errorf("bad \\%c escape", raw[i])
+		}
+		b.WriteRune(rune(r))
+		i += size
+	}
+	return b.String(), nil
+}
+
+// splitFlow splits the inside of a flow collection on top level commas.
+func splitFlow(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	quote := byte(0)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	if strings.TrimSpace(s[start:]) != "" {
+		parts = append(parts, s[start:])
+	}
+	return parts
+}
+
+// parsePlainYAML resolves an unquoted scalar with the YAML 1.2 core schema.
+func parsePlainYAML(text string) any {
+	switch text {
+	case "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if yamlInt.MatchString(text) {
+		// Leading zeros are decimal in YAML 1.2, not octal
+		base := 10
+		if strings.HasPrefix(text, "0o") || strings.HasPrefix(text, "0x") {
+			base = 0
+		}
+		if i, err := strconv.ParseInt(text, base, 64); err == nil {
+			return i
+		}
+	}
+	switch {
+	case yamlFloat.MatchString(text):
+		if f, err := strconv.ParseFloat(text, 64); err == nil {
+			return f
+		}
+	case yamlInf.MatchString(text):
+		return math.Inf(map[bool]int{true: -1, false: 1}[text[0] == '-'])
+	case yamlNaN.MatchString(text):
+		return math.NaN()
+	}
+	return text
+}
+
+// MarshalYAML writes a tree as YAML.
+func MarshalYAML(tree any) []byte {
+	var b strings.Builder
+	switch t := tree.(type) {
+	case *OrderedMap:
+		writeYAMLMap(&b, t, 0)
+	case []any:
+		writeYAMLList(&b, t, 0)
+	default:
+		b.WriteString(yamlScalar(t) + "\n")
+	}
+	return []byte(b.String())
+}
+
+func writeYAMLMap(b *strings.Builder, m *OrderedMap, indent int) {
+	var notes TreeNotes
+	if m.Notes != nil {
+		notes = *m.Notes
+	}
+
+	pad := strings.Repeat(" ", indent)
+	for _, key := range m.Keys {
+		writeYAMLComments(b, notes.Before[key], indent)
+		b.WriteString(pad + yamlKey(key) + ":")
+		writeYAMLValue(b, m.Values[key], notes.Inline[key], indent)
+	}
+	writeYAMLComments(b, notes.Trailing, indent)
+}
+
+// writeYAMLComments writes comments kept in the notes, one per line.
+func writeYAMLComments(b *strings.Builder, comments []string, indent int) {
+	pad := strings.Repeat(" ", indent)
+	for _, c := range comments {
+		if c == "" {
+			b.WriteString("\n")
+			continue
+		}
+		b.WriteString(pad + c + "\n")
+	}
+}
+
+func writeYAMLList(b *strings.Builder, items []any, indent int) {
+	pad := strings.Repeat(" ", indent)
+	for _, item := range items {
+		switch t := item.(type) {
+		case *OrderedMap:
+			if t.Notes != nil {
+				writeYAMLComments(b, t.Notes.Leading, indent)
+			}
+			if len(t.Keys) == 0 {
+				b.WriteString(pad + "- {}\n")
+				continue
+			}
+			// The first key shares the line with the dash
+			var item strings.Builder
+			writeYAMLMap(&item, t, indent+2)
+			b.WriteString(pad + "- " + strings.TrimPrefix(item.String(), pad+"  "))
+		case []any:
+			b.WriteString(pad + "-")
+			writeYAMLValue(b, t, "", indent)
+		default:
+			b.WriteString(pad + "- " + yamlScalar(t) + "\n")
+		}
+	}
+}
+
+// writeYAMLValue writes whatever follows "key:" or "-", nested values
+// indented below it, with comment at the end of the line.
+func writeYAMLValue(b *strings.Builder, value any, comment string, indent int) {
+	eol := "\n"
+	if comment != "" {
+		eol = " " + comment + "\n"
+	}
+
+	switch t := value.(type) {
+	case *OrderedMap:
+		if len(t.Keys) == 0 {
+			b.WriteString(" {}" + eol)
+			return
+		}
+		b.WriteString(eol)
+		writeYAMLMap(b, t, indent+2)
+	case []any:
+		if len(t) == 0 {
+			b.WriteString(" []" + eol)
+			return
+		}
+		b.WriteString(eol)
+		writeYAMLList(b, t, indent+2)
+	default:
+		b.WriteString(" " + yamlScalar(t) + eol)
+	}
+}
+
+func yamlKey(key string) string {
+	if key == "" || strings.ContainsAny(key, ":#\"'{}[],&*!|>%@`") || strings.TrimSpace(key) != key || strings.HasPrefix(key, "-") {
+		return strconv.Quote(key)
+	}
+	return key
+}
+
+// yamlScalar quotes strings that would otherwise be read back as something
+// else.
+func yamlScalar(value any) string {
+	switch t := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		if yamlNeedsQuotes(t) {
+			return strconv.Quote(t)
+		}
+		return t
+	case float64:
+		switch {
+		case math.IsInf(t, 1):
+			return ".inf"
+		case math.IsInf(t, -1):
+			return "-.inf"
+		case math.IsNaN(t):
+			return ".nan"
+		}
+		return formatFloat(t)
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+// formatFloat writes a finite float so it reads back as a float, not an
+// integer.
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if strings.ContainsAny(s, ".e") == false {
+		s += ".0"
+	}
+	return s
+}
+
+func yamlNeedsQuotes(s string) bool {
+	if s == "" || strings.TrimSpace(s) != s {
+		return true
+	}
+	if _, ok := parsePlainYAML(s).(string); ok == false {
+		return true
+	}
+	if strings.ContainsRune("-?:,[]{}#&*!|>'\"%@`", rune(s[0])) {
+		return true
+	}
+	if strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.HasSuffix(s, ":") {
+		return true
+	}
+	for _, r := range s {
+		if r < ' ' || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"empty", "", `{}`},
+		{"document start", "---\na: 1\n", `{"a": int(1)}`},
+		{"mapping", "a: x\nb: y\n", `{"a": "x", "b": "y"}`},
+		{"nested mapping", "a:\n  b: x\n  c:\n    d: y\n", `{"a": {"b": "x", "c": {"d": "y"}}}`},
+		{"empty value", "a:\nb: x\n", `{"a": null, "b": "x"}`},
+		{"sequence", "a:\n  - x\n  - y\n", `{"a": ["x", "y"]}`},
+		{"sequence at key indent", "a:\n- x\n- y\n", `{"a": ["x", "y"]}`},
+		{"sequence of mappings", "a:\n  - n: x\n    m: y\n  - n: z\n", `{"a": [{"n": "x", "m": "y"}, {"n": "z"}]}`},
+		{"nested sequence", "- - x\n  - y\n- z\n", `[["x", "y"], "z"]`},
+		{"empty item", "-\n- x\n", `[null, "x"]`},
+		{"comments", "# top\na: x # after\nb: 'y # not a comment'\n", `{"a": "x", "b": "y # not a comment"}`},
+		{"hash inside word", "a: x#y\n", `{"a": "x#y"}`},
+		{"quoted key", "\"a b\": x\n'c': y\n", `{"a b": "x", "c": "y"}`},
+		{"single quoted", "a: 'it''s'\n", `{"a": "it's"}`},
+		{"double quoted escapes", `a: "t\tn\nq\"s\/e\e\x41\u00e9\U0001F600\\"` + "\n", `{"a": "t\tn\nq\"s/e\x1bAé😀\\"}`},
+		{"double quoted special escapes", `a: "\0\a\b\v\f\r\ \_\N\L\P"` + "\n", `{"a": "\x00\a\b\v\f\r \u00a0\u0085\u2028\u2029"}`},
+		{"null", "a: ~\nb: null\nc: NULL\n", `{"a": null, "b": null, "c": null}`},
+		{"booleans", "a: true\nb: False\nc: yes\n", `{"a": true, "b": false, "c": "yes"}`},
+		{"integers", "a: 12\nb: -3\nc: +4\nd: 0x1F\ne: 0o17\nf: 010\n", `{"a": int(12), "b": int(-3), "c": int(4), "d": int(31), "e": int(15), "f": int(10)}`},
+		{"floats", "a: 1.5\nb: -.5\nc: 1e3\nd: 2.\n", `{"a": float(1.5), "b": float(-0.5), "c": float(1000), "d": float(2)}`},
+		{"special floats", "a: .inf\nb: -.Inf\nc: .nan\n", `{"a": float(+Inf), "b": float(-Inf), "c": float(nan)}`},
+		{"number-like strings", "a: 1-5\nb: 0x\nc: 1_000\nd: 0x1.8p1\ne: inf\n", `{"a": "1-5", "b": "0x", "c": "1_000", "d": "0x1.8p1", "e": "inf"}`},
+		{"colon without space", "a: http://x/y\n", `{"a": "http://x/y"}`},
+		{"flow list", "a: [x, 'y', 1, [z]]\n", `{"a": ["x", "y", int(1), ["z"]]}`},
+		{"flow mapping", "a: {b: x, c: [1, 2]}\n", `{"a": {"b": "x", "c": [int(1), int(2)]}}`},
+		{"empty flow", "a: []\nb: {}\n", `{"a": [], "b": {}}`},
+		{"literal block", "a: |\n  one\n    two\n\nb: x\n", `{"a": "one\n  two\n", "b": "x"}`},
+		{"literal strip", "a: |-\n  one\n  two\n", `{"a": "one\ntwo"}`},
+		{"literal keep", "a: |+\n  one\n\n", `{"a": "one\n\n"}`},
+		{"folded block", "a: >\n  one\n  two\n\n  three\n", `{"a": "one two\nthree\n"}`},
+		{"folded strip in sequence", "- >-\n  one\n  two\n", `["one two"]`},
+		{"crlf", "a: x\r\nb: y\r\n", `{"a": "x", "b": "y"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := ParseYAML([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("ParseYAML(%q) failed: %v", tt.in, err)
+			}
+			if got := dumpTree(tree); got != tt.want {
+				t.Errorf("ParseYAML(%q)\n got %s\nwant %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"anchor", "a: &x 1\n", "anchors are not supported"},
+		{"anchor on block", "a: &x\n  b: 1\n", "anchors are not supported"},
+		{"alias", "a: 1\nb: *x\n", "aliases are not supported"},
+		{"anchor in sequence", "- &x 1\n", "anchors are not supported"},
+		{"anchored key", "&x a: 1\n", "anchors are not supported"},
+		{"tag", "a: !!str 1\n", "tags are not supported"},
+		{"indentation indicator", "a: |2\n  x\n", "block scalar indicator"},
+		{"reserved indicator", "a: @x\n", "cannot start with @"},
+		{"directive", "%YAML 1.2\n---\na: 1\n", "directives are not supported"},
+		{"second document", "a: 1\n---\nb: 2\n", "multi-document"},
+		{"document end", "a: 1\n...\n", "multi-document"},
+		{"complex key", "? a\n: 1\n", "complex keys"},
+		{"tab indentation", "a:\n\tb: 1\n", "tabs"},
+		{"duplicate key", "a: 1\na: 2\n", "duplicate key"},
+		{"bad indentation", "a: 1\n  b: 2\n", "unexpected indentation"},
+		{"multi-line plain", "a: one\n  two\n", "unexpected indentation"},
+		{"unterminated double", "a: \"x\n", "unterminated string"},
+		{"unterminated single", "a: 'x\n", "unterminated string"},
+		{"multi-line flow", "a: [x,\n  y]\n", "unterminated list"},
+		{"unknown escape", `a: "\q"` + "\n", "unknown escape"},
+		{"bare quote", `a: "x"y"` + "\n", "unescaped"},
+		{"short escape", `a: "\u12"` + "\n", "short"},
+		{"not a mapping entry", "a: 1\nb\n", "expected \"key: value\""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := ParseYAML([]byte(tt.in))
+			if err == nil {
+				t.Fatalf("ParseYAML(%q) = %s, want an error containing %q", tt.in, dumpTree(tree), tt.want)
+			}
+			if strings.Contains(err.Error(), tt.want) == false {
+				t.Errorf("ParseYAML(%q) error = %q, want it to contain %q", tt.in, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshalYAMLRoundTrip(t *testing.T) {
+	tests := []string{
+		"a: x\nb:\n  - 1\n  - true\n  - null\n  - 1.5\n",
+		"a:\n  - n: x\n    m:\n      - y\n  - {}\nb: []\n",
+		`a: ["", " x", "1", "true", "~", "- x", "a: b", "x #y", "&x", "*x", "!x", "|", "@x", "t\tab", "new\nline", "it's", "q\"uote", "0x1F", "1e3", ".inf"]` + "\n",
+		"a: .inf\nb: -.inf\nc: 2.0\nd: 1e+300\n",
+		"\"odd: key\": 1\n\"- dash\": 2\n",
+	}
+	for _, in := range tests {
+		tree, err := ParseYAML([]byte(in))
+		if err != nil {
+			t.Fatalf("ParseYAML(%q) failed: %v", in, err)
+		}
+		out := MarshalYAML(tree)
+		back, err := ParseYAML(out)
+		if err != nil {
+			t.Fatalf("MarshalYAML output does not parse: %v\n%s", err, out)
+		}
+		if dumpTree(back) != dumpTree(tree) {
+			t.Errorf("round trip of %q\n got %s\nwant %s\nvia\n%s", in, dumpTree(back), dumpTree(tree), out)
+		}
+	}
+}
+
+func TestMarshalYAMLKeepsComments(t *testing.T) {
+	in := `---
+# Global settings
+Config: /config/ # state lives here
+
+# Channels
+PodcastDownload:
+  # The first one
+  - Name: One
+    ChannelID: UCrrrrrrrrrrrrrrrrrrrrrr # pinned
+  # - Name: Commented out
+  - Name: Two
+    # Slow down
+    ExtraArgs: "--sleep-interval 5"
+    Notes: "# not a comment"
+# the end
+`
+	tree, err := ParseYAML([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := string(MarshalYAML(tree)); out != in {
+		t.Errorf("rewritten file differs\n got:\n%s\nwant:\n%s", out, in)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"reflect"
+	"time"
+)
+
+const (
+	DefaultDaemonInterval = 15 * time.Minute
+	// SettingsPollInterval is how often the daemon checks the settings file
+	// for changes between runs.
+	SettingsPollInterval = 10 * time.Second
+)
+
+// SettingsWatcher keeps the settings the daemon is running with and picks
+// up changes to the settings file. A changed file is validated as soon as it
+// is seen but only applied by Apply, at the next scheduling tick; a file that
+// does not load or has global problems is reported and the previous settings
+// stay active.
+type SettingsWatcher struct {
+	Path string
+
+	Current settings
+	Report  ValidationReport
+
+	pending       *settings
+	pendingReport ValidationReport
+	seen          [sha256.Size]byte
+}
+
+// NewSettingsWatcher starts watching path, running with s until it changes.
+func NewSettingsWatcher(path string, s settings, report ValidationReport) *SettingsWatcher {
+	w := &SettingsWatcher{Path: path, Current: s, Report: report}
+	w.seen, _ = settingsChecksum(path)
+	return w
+}
+
+func settingsChecksum(path string) ([sha256.Size]byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(content), nil
+}
+
+// Check looks for a change to the settings file and validates it.
+func (w *SettingsWatcher) Check(ctx context.Context) {
+	logger := slog.With("phase", "reload", "settings", w.Path)
+
+	sum, err := settingsChecksum(w.Path)
+	if err != nil {
+		if sum != w.seen {
+			logger.Error("reading settings failed, keeping the current settings", "error", err)
+			w.seen = sum
+		}
+		return
+	}
+	if sum == w.seen {
+		return
+	}
+	w.seen = sum
+
+	s, err := LoadSettings(w.Path)
+	if err != nil {
+		logger.Error("new settings not valid, keeping the current settings", "error", err)
+		w.pending = nil
+		return
+	}
+	// Problems quote the settings, secrets included, so they are known
+	// before anything is logged
+	RegisterSettingsSecrets(s)
+	ResolveSettingsChannelIDs(ctx, &s)
+	report := ValidateSettings(s)
+	if len(report.Global) > 0 {
+		for _, problem := range report.Global {
+			logger.Error("setting not valid", "field", problem.Field, "problem", problem.Message)
+		}
+		logger.Error("new settings not valid, keeping the current settings", "problems", len(report.Global))
+		w.pending = nil
+		return
+	}
+
+	for _, problem := range report.Problems() {
+		logger.Warn("setting not valid", "channel", problem.Channel, "field", problem.Field, "problem", problem.Message)
+	}
+	logger.Info("settings changed, applying at the next run")
+	w.pending = &s
+	w.pendingReport = report
+}
+
+// Apply switches to the pending settings, if any, and logs which channels
+// were added, removed or changed.
+func (w *SettingsWatcher) Apply() {
+	if w.pending == nil {
+		return
+	}
+	logger := slog.With("phase", "reload", "settings", w.Path)
+
+	old := map[string]YouTubeDownload{}
+	for _, p := range w.Current.PodcastDownload {
+		old[p.ChannelID], _ = ResolveChannel(w.Current, p)
+	}
+	for _, p := range w.pending.PodcastDownload {
+		resolved, _ := ResolveChannel(*w.pending, p)
+		previous, existed := old[p.ChannelID]
+		delete(old, p.ChannelID)
+		switch {
+		case existed == false:
+			logger.Info("channel added", "channel", p.Name, "channel_id", p.ChannelID)
+		case reflect.DeepEqual(previous, resolved) == false:
+			logger.Info("channel changed", "channel", p.Name, "channel_id", p.ChannelID)
+		}
+	}
+	for id, p := range old {
+		logger.Info("channel removed", "channel", p.Name, "channel_id", id)
+	}
+
+	w.Current, w.Report = *w.pending, w.pendingReport
+	w.pending = nil
+
+	if logerr := SetupLogging(w.Current.LogLevel, w.Current.LogFormat); logerr != nil {
+		slog.Warn("logging settings not valid", "phase", "config", "error", logerr)
+	}
+	logger.Info("settings applied", "channels", len(w.Current.PodcastDownload))
+}
+
+// RunDaemon runs every channel each interval until ctx is done, reloading
+// the settings file when it changes. It returns the exit code.
+func RunDaemon(ctx context.Context, opts Options, s settings, report ValidationReport, stderr io.Writer) int {
+	fs := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	interval := fs.Duration("interval", DefaultDaemonInterval, "time between runs")
+	if err := fs.Parse(opts.Args); err != nil {
+		return 2
+	}
+	if *interval <= 0 {
+		fmt.Fprintln(stderr, "--interval must be more than zero")
+		return 2
+	}
+
+	watcher := NewSettingsWatcher(opts.ConfigPath, s, report)
+	run := time.NewTicker(*interval)
+	defer run.Stop()
+	poll := time.NewTicker(SettingsPollInterval)
+	defer poll.Stop()
+
+	slog.Info("daemon started", "phase", "daemon", "interval", interval.String(), "settings", opts.ConfigPath)
+	RunChannels(ctx, watcher.Current, watcher.Report, nil, "")
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("daemon stopping", "phase", "daemon")
+			return 0
+		case <-poll.C:
+			watcher.Check(ctx)
+		case <-run.C:
+			watcher.Check(ctx)
+			watcher.Apply()
+			RunChannels(ctx, watcher.Current, watcher.Report, nil, "")
+		}
+	}
+}
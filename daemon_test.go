@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSettingsWatcherRedactsNewSecrets(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "settings.xml")
+	write := func(cookies string) {
+		t.Helper()
+		content := `<settings><Config>` + dir + `/</Config><PodcastDownload><Name>Chan</Name><ChannelID>UCrrrrrrrrrrrrrrrrrrrrrr</ChannelID><YouTubeURL>https://www.youtube.com/channel/UCrrrrrrrrrrrrrrrrrrrrrr</YouTubeURL>` + cookies + `</PodcastDownload></settings>`
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("")
+	s, err := LoadSettings(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewSettingsWatcher(path, s, ValidateSettings(s))
+
+	var logs bytes.Buffer
+	saved := slog.Default()
+	defer slog.SetDefault(saved)
+	slog.SetDefault(slog.New(slog.NewTextHandler(NewRedactWriter(&logs), nil)))
+
+	write("<Cookies>/no/such/daemon-secret-cookies.txt</Cookies>")
+	w.Check(context.Background())
+	if strings.Contains(logs.String(), "Cookies") == false {
+		t.Fatalf("the missing cookies file was not reported:\n%s", logs.String())
+	}
+	if strings.Contains(logs.String(), "daemon-secret-cookies") {
+		t.Errorf("the new cookies file was logged:\n%s", logs.String())
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultRetention is how long downloaded episodes are kept when no
+// Retention is set.
+const DefaultRetention = "7d"
+
+// ChannelDefaults are the settings a PodcastDownload inherits when it does
+// not set them itself. PlaylistItems, MediaFolder, PushoverUserToken and
+// LimitRate through ExtraArgs fall back further to the global settings of the
+// same name.
+type ChannelDefaults struct {
+	PlaylistItems string `xml:"PlaylistItems"`
+	MediaFolder   string `xml:"MediaFolder"`
+	FileFormat    string `xml:"FileFormat"`
+	FileQuality   string `xml:"FileQuality"`
+	// Retention is how long episodes are kept, such as "7d" or "36h"; "0"
+	// keeps them forever.
+	Retention         string `xml:"Retention"`
+	PushoverUserToken string `xml:"PushoverUserToken"`
+	PushoverAppToken  string `xml:"PushoverAppToken"`
+	PushoverPriority  string `xml:"PushoverPriority"`
+	PushoverSound     string `xml:"PushoverSound"`
+	// LimitRate caps the download speed, as yt-dlp's --limit-rate such as
+	// "2M"; empty means no limit.
+	LimitRate string `xml:"LimitRate"`
+	// DownloadWindow is when downloads may run and BacklogWindow when videos
+	// older than BacklogAge may, such as "01:00-07:00"; empty means any time.
+	// Videos outside their window are left for a later run; fetching a video
+	// ignores both.
+	DownloadWindow string `xml:"DownloadWindow"`
+	BacklogWindow  string `xml:"BacklogWindow"`
+	// Cookies is a cookies.txt file for age-restricted and members-only
+	// videos, Proxy a proxy URL, ExtractorArgs space separated yt-dlp
+	// --extractor-args values and ExtraArgs further yt-dlp options, such as
+	// "--sleep-interval 5". Options the tool sets itself are refused.
+	Cookies       string `xml:"Cookies"`
+	Proxy         string `xml:"Proxy"`
+	ExtractorArgs string `xml:"ExtractorArgs"`
+	ExtraArgs     string `xml:"ExtraArgs"`
+	// Filters: MinDuration and MaxDuration are Go durations; TitleInclude
+	// and TitleExclude regular expressions, in the syntax Go and yt-dlp's
+	// Python share; SkipShorts, SkipLive and SkipPremieres (until they have
+	// aired) true or false; UploadedAfter and UploadedBefore dates such as
+	// 2024-01-31, or ages such as 90d. Filtered videos are not downloaded.
+	MinDuration    string `xml:"MinDuration"`
+	MaxDuration    string `xml:"MaxDuration"`
+	TitleInclude   string `xml:"TitleInclude"`
+	TitleExclude   string `xml:"TitleExclude"`
+	SkipShorts     string `xml:"SkipShorts"`
+	SkipLive       string `xml:"SkipLive"`
+	SkipPremieres  string `xml:"SkipPremieres"`
+	UploadedAfter  string `xml:"UploadedAfter"`
+	UploadedBefore string `xml:"UploadedBefore"`
+	// Backfill is oldest, newest or off: whether each run also downloads
+	// BackfillBatch (5 by default) of the channel's older videos; see
+	// Backfill.
+	Backfill      string `xml:"Backfill"`
+	BackfillBatch string `xml:"BackfillBatch"`
+}
+
+// Where an effective channel setting came from
+const (
+	SourceChannel  = "channel"
+	SourceDefaults = "defaults"
+	SourceGlobal   = "global"
+	SourceBuiltin  = "built-in"
+)
+
+// ResolveChannel works out the effective settings of a PodcastDownload: its
+// own value, else Defaults, else the global setting, else the built-in
+// default. DownloadArchive defaults to Config/<ChannelID>.archive. The map
+// gives the source of every inherited setting.
+func ResolveChannel(s settings, p YouTubeDownload) (YouTubeDownload, map[string]string) {
+	sources := map[string]string{}
+	channel := reflect.ValueOf(&p).Elem()
+	defaults := reflect.ValueOf(s.Defaults)
+	global := reflect.ValueOf(s)
+
+	for _, f := range reflect.VisibleFields(defaults.Type()) {
+		field := channel.FieldByName(f.Name)
+		if field.String() != "" {
+			sources[f.Name] = SourceChannel
+			continue
+		}
+
+		if value := defaults.FieldByIndex(f.Index).String(); value != "" {
+			field.SetString(value)
+			sources[f.Name] = SourceDefaults
+			continue
+		}
+
+		if g := global.FieldByName(f.Name); g.IsValid() && g.String() != "" {
+			field.SetString(g.String())
+			sources[f.Name] = SourceGlobal
+		}
+	}
+
+	if p.Retention == "" {
+		p.Retention = DefaultRetention
+		sources["Retention"] = SourceBuiltin
+	}
+	if p.DownloadArchive == "" && p.ChannelID != "" {
+		p.DownloadArchive = s.Config + p.ChannelID + ".archive"
+		sources["DownloadArchive"] = SourceBuiltin
+	}
+	return p, sources
+}
+
+// ParseRetention reads a Retention setting: a whole number of days such as
+// "14d", or a Go duration such as "36h". Zero keeps files forever.
+func ParseRetention(retention string) (time.Duration, error) {
+	if retention == "" {
+		retention = DefaultRetention
+	}
+	if retention == "0" {
+		return 0, nil
+	}
+
+	if days, ok := strings.CutSuffix(retention, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("%q is not a number of days such as 7d", retention)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(retention)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%q is not a duration such as 7d or 36h", retention)
+	}
+	return d, nil
+}
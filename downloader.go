@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DownloadJob is what a Downloader needs to know about a channel run.
+type DownloadJob struct {
+	Channel string
+	// URL is the channel URL, or a single video's for fetch
+	URL           string
+	Folder        string // the channel's Season_1 folder, ending in /
+	Archive       string
+	PlaylistItems string
+	FileFormat    string
+	FileQuality   string
+	LimitRate     string
+	// Options are the channel's own yt-dlp options, such as --cookies
+	Options []string
+	Logger  *slog.Logger
+}
+
+// Item is one video a channel has not downloaded yet. Uploaded is zero when
+// the listing did not say.
+type Item struct {
+	ID       string
+	URL      string
+	Uploaded time.Time
+}
+
+// parseUploadDate reads yt-dlp's YYYYMMDD upload_date.
+func parseUploadDate(date string) time.Time {
+	t, err := time.Parse("20060102", date)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// publishedAt is when the video behind an .info.json went out: its
+// timestamp, else its upload_date, else the zero time when neither is known.
+func publishedAt(infoJSON string) time.Time {
+	content, err := os.ReadFile(infoJSON)
+	if err != nil {
+		return time.Time{}
+	}
+	var info struct {
+		Timestamp  float64 `json:"timestamp"`
+		UploadDate string  `json:"upload_date"`
+	}
+	if json.Unmarshal(content, &info) != nil {
+		return time.Time{}
+	}
+	if info.Timestamp > 0 {
+		return time.Unix(int64(info.Timestamp), 0).UTC()
+	}
+	return parseUploadDate(info.UploadDate)
+}
+
+// SortByPublished puts downloads in the order their videos went out, oldest
+// first. Ones whose date is not known keep their order at the end.
+func SortByPublished(downloads []DownloadResult) {
+	published := map[string]time.Time{}
+	for _, d := range downloads {
+		published[d.InfoJSON] = publishedAt(d.InfoJSON)
+	}
+	sort.SliceStable(downloads, func(i, j int) bool {
+		a, b := published[downloads[i].InfoJSON], published[downloads[j].InfoJSON]
+		if a.IsZero() || b.IsZero() {
+			return b.IsZero() && a.IsZero() == false
+		}
+		return a.Before(b)
+	})
+}
+
+// DownloadResult lists the files a download produced.
+type DownloadResult struct {
+	ID          string
+	Media       string
+	InfoJSON    string
+	Description string
+}
+
+// Downloader fetches videos and channel details. YTDLP is the real one;
+// FakeDownloader serves fixture files so the numbering, artwork and
+// notification steps can be exercised without the network. Every call stops
+// when ctx is done.
+type Downloader interface {
+	// ListNew lists the videos of job.URL within PlaylistItems that are not
+	// in the download archive yet, in playlist order. Without an Archive it
+	// lists them all.
+	ListNew(ctx context.Context, job DownloadJob) ([]Item, error)
+	// Download downloads one video into job.Folder as <id>.<ext>, with its
+	// .info.json and .description, and records it in the archive.
+	Download(ctx context.Context, job DownloadJob, item Item) (DownloadResult, error)
+	// ChannelMetadata looks up a channel without listing its videos.
+	ChannelMetadata(ctx context.Context, url string) (ChannelMetadata, error)
+}
+
+// ActiveDownloader is the Downloader every command uses.
+var ActiveDownloader Downloader = &YTDLP{Path: "yt-dlp"}
+
+func watchURL(id string) string {
+	return "https://www.youtube.com/watch?v=" + id
+}
+
+// readArchive lists the video IDs in a download archive, whose lines are
+// "youtube <id>".
+func readArchive(path string) map[string]bool {
+	archived := map[string]bool{}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return archived
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if _, id, ok := strings.Cut(strings.TrimSpace(line), " "); ok {
+			archived[id] = true
+		}
+	}
+	return archived
+}
+
+// resultFor names the files a download of id into folder produces.
+func resultFor(folder string, id string, format string) DownloadResult {
+	base := folder + id
+	return DownloadResult{ID: id, Media: base + "." + format, InfoJSON: base + ".info.json", Description: base + ".description"}
+}
+
+// ~~~~~~~~~~~~~~~~~~~~~~ yt-dlp ~~~~~~~~~~~~~~~~~~~~~~
+
+// YTDLP runs the yt-dlp program found at Path.
+type YTDLP struct {
+	Path string
+}
+
+// run runs yt-dlp, logging its output through logger, or capturing stdout
+// when it is given. Lines intercept deals with are not logged. The returned
+// error is a *YTDLPError classifying the failure.
+//
+// yt-dlp runs in its own process group, so when ctx is done the ffmpeg it
+// started for merging is stopped along with it: the group gets SIGTERM, and
+// SIGKILL once KillGrace has passed.
+func (y *YTDLP) run(ctx context.Context, logger *slog.Logger, stdout io.Writer, intercept func(string) bool, args ...string) error {
+	cmd := exec.CommandContext(ctx, y.Path, args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	// The SIGKILL is called off once yt-dlp has exited, so it cannot reach a
+	// process group whose ID has been handed out again
+	var kill *time.Timer
+	cmd.Cancel = func() error {
+		pgid := -cmd.Process.Pid
+		kill = time.AfterFunc(KillGrace, func() { syscall.Kill(pgid, syscall.SIGKILL) })
+		return syscall.Kill(pgid, syscall.SIGTERM)
+	}
+	cmd.WaitDelay = 2 * KillGrace
+	logger.Debug("yt-dlp command", "command", y.Path+" "+strings.Join(args, " "))
+
+	stderr := &tailBuffer{Max: 64 * 1024}
+	stderrLog := NewLogWriter(logger.With("stream", "stderr"))
+	stderrLog.Intercept = intercept
+	defer stderrLog.Flush()
+	cmd.Stderr = io.MultiWriter(stderrLog, stderr)
+	if stdout == nil {
+		stdoutLog := NewLogWriter(logger.With("stream", "stdout"))
+		stdoutLog.Intercept = intercept
+		defer stdoutLog.Flush()
+		stdout = stdoutLog
+	}
+	cmd.Stdout = stdout
+
+	err := cmd.Run()
+	// Run has waited for Cancel, so kill is safe to read
+	if kill != nil {
+		kill.Stop()
+	}
+	if ctx.Err() != nil {
+		return &YTDLPError{Class: FailureTimeout, Err: ctx.Err(), Stderr: Redact(stderr.String())}
+	}
+	if err != nil {
+		return &YTDLPError{Class: ClassifyYTDLPFailure(err, stderr.String()), Err: err, Stderr: Redact(stderr.String())}
+	}
+	return nil
+}
+
+func (y *YTDLP) ListNew(ctx context.Context, job DownloadJob) ([]Item, error) {
+	var out bytes.Buffer
+	// approximate_date gets an upload date into the flat listing, worked out
+	// from "3 days ago"
+	args := append(append([]string{}, job.Options...), "--flat-playlist", "--print", "%(id)s %(upload_date)s", "--extractor-args", "youtubetab:approximate_date", "--playlist-items", job.PlaylistItems)
+	if job.Archive != "" {
+		args = append(args, "--download-archive", job.Archive)
+	}
+	// A fetched video is listed on its own, as a watch URL that also names a
+	// playlist would list the whole playlist
+	listURL := ChannelVideosURL(job.URL)
+	if id, ok := VideoIDFromURL(job.URL); ok {
+		listURL = watchURL(id)
+	}
+	args = append(args, "--no-playlist", listURL)
+	if err := y.run(ctx, job.Logger, &out, nil, args...); err != nil {
+		return nil, err
+	}
+
+	var items []Item
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		item := Item{ID: fields[0], URL: watchURL(fields[0])}
+		if len(fields) > 1 {
+			item.Uploaded = parseUploadDate(fields[1])
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (y *YTDLP) Download(ctx context.Context, job DownloadJob, item Item) (DownloadResult, error) {
+	parser := NewOutputParser(job.Channel, job.Logger)
+	args := append(append([]string{}, job.Options...), "-v", "-o", job.Folder+"%(id)s.%(ext)s", "--no-playlist", "--write-info-json", "--no-write-playlist-metafiles", "--download-archive", job.Archive, "--restrict-filenames", "--add-metadata", "--merge-output-format", job.FileFormat, "--format", job.FileQuality, "--abort-on-error", "--abort-on-unavailable-fragment", "--no-overwrites", "--continue", "--write-description")
+	if job.LimitRate != "" {
+		args = append(args, "--limit-rate", job.LimitRate)
+	}
+	args = append(append(args, progressArgs...), item.URL)
+	err := y.run(ctx, job.Logger, nil, parser.Line, args...)
+
+	result := resultFor(job.Folder, item.ID, job.FileFormat)
+	if file, ok := parser.Files[item.ID]; ok {
+		result.Media = file
+	}
+	if err != nil {
+		LiveProgress.Update(Progress{Channel: job.Channel, VideoID: item.ID, Status: "error", Updated: time.Now()})
+	}
+	return result, err
+}
+
+func (y *YTDLP) ChannelMetadata(ctx context.Context, url string) (ChannelMetadata, error) {
+	var meta ChannelMetadata
+	var out bytes.Buffer
+	logger := slog.With("phase", "metadata", "youtube_url", url)
+	if err := y.run(ctx, logger, &out, nil, "--dump-single-json", "--flat-playlist", "--playlist-items", "0", "--skip-download", url); err != nil {
+		return meta, err
+	}
+
+	if err := json.Unmarshal(out.Bytes(), &meta); err != nil {
+		return meta, fmt.Errorf("reading yt-dlp metadata: %w", err)
+	}
+	if meta.ChannelID == "" {
+		return meta, fmt.Errorf("%s is not a channel", url)
+	}
+	return meta, nil
+}
+
+// ~~~~~~~~~~~~~~~~~~~~~~ Fake ~~~~~~~~~~~~~~~~~~~~~~~~
+
+// FakeDownloader serves videos from a fixtures folder instead of YouTube.
+// Every <id>.info.json in Fixtures is a video of every channel; <id>.jpg
+// next to it becomes its artwork, and channel.json is the answer to
+// ChannelMetadata. PlaylistItems is ignored.
+type FakeDownloader struct {
+	Fixtures string
+}
+
+func (f *FakeDownloader) ListNew(ctx context.Context, job DownloadJob) ([]Item, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	matches, err := filepath.Glob(filepath.Join(f.Fixtures, "*.info.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+
+	archived := readArchive(job.Archive)
+
+	// A video URL lists only that video
+	only, _ := VideoIDFromURL(job.URL)
+
+	var items []Item
+	for _, match := range matches {
+		id := strings.TrimSuffix(filepath.Base(match), ".info.json")
+		if archived[id] || (only != "" && id != only) {
+			continue
+		}
+
+		var info struct {
+			UploadDate string `json:"upload_date"`
+		}
+		if content, err := os.ReadFile(match); err == nil {
+			json.Unmarshal(content, &info)
+		}
+		items = append(items, Item{ID: id, URL: watchURL(id), Uploaded: parseUploadDate(info.UploadDate)})
+	}
+	return items, nil
+}
+
+func (f *FakeDownloader) Download(ctx context.Context, job DownloadJob, item Item) (DownloadResult, error) {
+	result := resultFor(job.Folder, item.ID, job.FileFormat)
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+
+	content, err := os.ReadFile(filepath.Join(f.Fixtures, item.ID+".info.json"))
+	if err != nil {
+		return result, err
+	}
+	var info map[string]any
+	if err := json.Unmarshal(content, &info); err != nil {
+		return result, fmt.Errorf("fixture %s.info.json: %w", item.ID, err)
+	}
+
+	artwork, err := filepath.Abs(filepath.Join(f.Fixtures, item.ID+".jpg"))
+	if err == nil && IsValid(artwork) {
+		info["thumbnail"] = "file://" + artwork
+	}
+	content, _ = json.Marshal(info)
+
+	files := map[string][]byte{
+		result.InfoJSON:    content,
+		result.Description: []byte(fmt.Sprint(info["description"])),
+		result.Media:       []byte("fake " + job.FileFormat + " for " + item.ID + "\n"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(name, data, 0644); err != nil {
+			return result, err
+		}
+	}
+
+	LiveProgress.Update(Progress{Channel: job.Channel, VideoID: item.ID, Status: "finished", Percent: 100, Updated: time.Now()})
+
+	archive, err := os.OpenFile(job.Archive, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return result, err
+	}
+	defer archive.Close()
+	_, err = fmt.Fprintln(archive, "youtube "+item.ID)
+	return result, err
+}
+
+func (f *FakeDownloader) ChannelMetadata(ctx context.Context, url string) (ChannelMetadata, error) {
+	var meta ChannelMetadata
+	content, err := os.ReadFile(filepath.Join(f.Fixtures, "channel.json"))
+	if err != nil {
+		return meta, err
+	}
+	err = json.Unmarshal(content, &meta)
+	return meta, err
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListNewFetchesOnlyTheVideo(t *testing.T) {
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	script := filepath.Join(dir, "yt-dlp")
+	body := "#!/bin/sh\nprintf '%s\\n' \"$@\" > " + argsFile + "\necho 'dQw4w9WgXcQ 20240101'\necho 'otherVideo1 20240102'\n"
+	if err := os.WriteFile(script, []byte(body), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	y := &YTDLP{Path: script}
+	job := DownloadJob{Channel: "Test", URL: "https://www.youtube.com/watch?list=PL123&v=dQw4w9WgXcQ", PlaylistItems: "1-10", Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	if _, err := y.ListNew(context.Background(), job); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	if got := args[len(args)-1]; got != watchURL("dQw4w9WgXcQ") {
+		t.Errorf("listed %q, want %q", got, watchURL("dQw4w9WgXcQ"))
+	}
+	for _, arg := range args {
+		if strings.Contains(arg, "list=") {
+			t.Errorf("argument %q still names the playlist", arg)
+		}
+	}
+}
+
+func TestYTDLPStopsWhenContextEnds(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "yt-dlp")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nsleep 30\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := (&YTDLP{Path: script}).run(ctx, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, nil)
+	if FailureClassOf(err) != FailureTimeout {
+		t.Errorf("run = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > KillGrace {
+		t.Errorf("run took %s after SIGTERM", elapsed)
+	}
+}
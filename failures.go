@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// FailureClass is a coarse classification of why a yt-dlp run failed, used to
+// tell a human what to go and fix.
+type FailureClass string
+
+const (
+	FailureCookies     FailureClass = "cookies"
+	FailureRateLimited FailureClass = "rate-limited"
+	FailureFormat      FailureClass = "format-unavailable"
+	FailureUnavailable FailureClass = "video-unavailable"
+	FailureExtractor   FailureClass = "extractor-broken"
+	FailureNetwork     FailureClass = "network"
+	FailureNotFound    FailureClass = "yt-dlp-missing"
+	FailureUpcoming    FailureClass = "upcoming"
+	FailureTimeout     FailureClass = "timed-out"
+	FailureUnknown     FailureClass = "unknown"
+)
+
+// Transient failures may well go away by themselves, so they are retried.
+func (c FailureClass) Transient() bool {
+	return c == FailureRateLimited || c == FailureNetwork
+}
+
+// PerVideo failures are about one video and will not go away by retrying,
+// so the video is skipped and the channel carries on.
+func (c FailureClass) PerVideo() bool {
+	return c == FailureUnavailable || c == FailureFormat
+}
+
+// FailureClassOf is the class of a yt-dlp error, unknown for anything else.
+func FailureClassOf(err error) FailureClass {
+	var ytErr *YTDLPError
+	if errors.As(err, &ytErr) {
+		return ytErr.Class
+	}
+	return FailureUnknown
+}
+
+// failurePatterns maps fragments of yt-dlp's error lines to a class. The
+// first match wins, so more specific fragments come first. yt-dlp suggests
+// --cookies after any reason that mentions signing in, private videos
+// included, so the per-video reasons go before the cookie ones and a bare
+// mention of cookies means nothing.
+var failurePatterns = []struct {
+	Class     FailureClass
+	Fragments []string
+}{
+	{FailureRateLimited, []string{"http error 429", "too many requests"}},
+	{FailureFormat, []string{"requested format is not available", "format is not available"}},
+	{FailureUpcoming, []string{"premieres in", "this live event will begin", "premiere will begin"}},
+	{FailureUnavailable, []string{"private video", "members-only", "join this channel", "video unavailable"}},
+	{FailureCookies, []string{"sign in to confirm you're not a bot", "sign in to confirm you’re not a bot", "sign in to confirm your age", "login required"}},
+	{FailureUnavailable, []string{"this video has been removed", "this video is not available", "age-restricted"}},
+	{FailureExtractor, []string{"unable to extract", "nsig extraction failed", "please report this issue", "confirm you are on the latest version"}},
+	{FailureNetwork, []string{"timed out", "connection reset", "temporary failure in name resolution", "network is unreachable", "unable to download webpage", "http error 500", "http error 502", "http error 503", "http error 504", "incomplete read", "connection refused"}},
+}
+
+// YTDLPError is returned when yt-dlp exits unsuccessfully. Stderr holds the
+// tail of yt-dlp's error output.
+type YTDLPError struct {
+	Class  FailureClass
+	Err    error
+	Stderr string
+}
+
+func (e *YTDLPError) Error() string {
+	if e.Stderr == "" {
+		return fmt.Sprintf("yt-dlp %s: %v", e.Class, e.Err)
+	}
+	return fmt.Sprintf("yt-dlp %s: %v: %s", e.Class, e.Err, e.Stderr)
+}
+
+func (e *YTDLPError) Unwrap() error {
+	return e.Err
+}
+
+// ClassifyYTDLPFailure works out a FailureClass from the yt-dlp process error
+// and the error lines it printed on stderr. The rest of stderr is left out:
+// with -v it echoes the command line, cookie options and all.
+func ClassifyYTDLPFailure(err error, stderr string) FailureClass {
+	if errors.Is(err, exec.ErrNotFound) {
+		return FailureNotFound
+	}
+
+	lower := strings.ToLower(ErrorLines(stderr))
+	for _, p := range failurePatterns {
+		for _, fragment := range p.Fragments {
+			if strings.Contains(lower, fragment) {
+				return p.Class
+			}
+		}
+	}
+	return FailureUnknown
+}
+
+// ErrorLines keeps only the "ERROR:" lines of yt-dlp output, falling back to
+// the last few lines, so notifications stay short.
+func ErrorLines(output string) string {
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "ERROR:") {
+			lines = append(lines, strings.TrimSpace(line))
+		}
+	}
+
+	if len(lines) == 0 {
+		all := strings.Split(strings.TrimSpace(output), "\n")
+		if len(all) > 3 {
+			all = all[len(all)-3:]
+		}
+		lines = all
+	}
+	return strings.Join(lines, "\n")
+}
+
+// tailBuffer is an io.Writer that keeps only the last Max bytes written to it.
+type tailBuffer struct {
+	Max  int
+	data []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.data = append(t.data, p...)
+	if len(t.data) > t.Max {
+		t.data = t.data[len(t.data)-t.Max:]
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	return string(t.data)
+}
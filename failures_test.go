@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+)
+
+func TestClassifyYTDLPFailure(t *testing.T) {
+	tests := map[string]FailureClass{
+		"ERROR: [youtube] abc: HTTP Error 429: Too Many Requests":                                                           FailureRateLimited,
+		"ERROR: [youtube] abc: Requested format is not available. Use --list-formats for a list of available formats":       FailureFormat,
+		"ERROR: [youtube] abc: Premieres in 3 hours":                                                                        FailureUpcoming,
+		"ERROR: [youtube] abc: Private video. Sign in if you've been granted access to this video. Use --cookies":           FailureUnavailable,
+		"ERROR: [youtube] abc: Sign in to confirm you're not a bot. Use --cookies-from-browser or --cookies":                FailureCookies,
+		"ERROR: [youtube] abc: Sign in to confirm your age. This video may be inappropriate for some users.":                FailureCookies,
+		"ERROR: [youtube] abc: Video unavailable. This video has been removed by the uploader":                              FailureUnavailable,
+		"ERROR: [youtube] abc: Unable to extract initial player response; please report this issue":                         FailureExtractor,
+		"ERROR: [youtube] abc: Unable to download webpage: <urlopen error [Errno -3] Temporary failure in name resolution>": FailureNetwork,
+		"ERROR: something nobody has seen before":                                                                           FailureUnknown,
+		// Only the error lines count, not the command line -v echoes
+		"[debug] Command-line config: ['--cookies', 'cookies.txt']\nERROR: [youtube] abc: Connection reset by peer": FailureNetwork,
+		"[debug] Command-line config: ['--cookies', 'cookies.txt']\nERROR: disk full":                               FailureUnknown,
+	}
+	for stderr, want := range tests {
+		if got := ClassifyYTDLPFailure(errors.New("exit status 1"), stderr); got != want {
+			t.Errorf("ClassifyYTDLPFailure(%q) = %s, want %s", stderr, got, want)
+		}
+	}
+
+	missing := &exec.Error{Name: "yt-dlp", Err: exec.ErrNotFound}
+	if got := ClassifyYTDLPFailure(missing, ""); got != FailureNotFound {
+		t.Errorf("ClassifyYTDLPFailure of a missing yt-dlp = %s, want %s", got, FailureNotFound)
+	}
+}
+
+func TestFailureClassOf(t *testing.T) {
+	ytErr := &YTDLPError{Class: FailureCookies, Err: errors.New("exit status 1")}
+	tests := []struct {
+		err  error
+		want FailureClass
+	}{
+		{nil, FailureUnknown},
+		{errors.New("disk full"), FailureUnknown},
+		{ytErr, FailureCookies},
+		{fmt.Errorf("listing: %w", ytErr), FailureCookies},
+	}
+	for _, tt := range tests {
+		if got := FailureClassOf(tt.err); got != tt.want {
+			t.Errorf("FailureClassOf(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestErrorLines(t *testing.T) {
+	tests := map[string]string{
+		"[youtube] abc: Downloading webpage\nERROR: first\nWARNING: skipped\n  ERROR: second \n": "ERROR: first\nERROR: second",
+		"one\ntwo\nthree\nfour\n": "two\nthree\nfour",
+		"":                        "",
+	}
+	for output, want := range tests {
+		if got := ErrorLines(output); got != want {
+			t.Errorf("ErrorLines(%q) = %q, want %q", output, got, want)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ShortsMaxDuration is the longest a YouTube Short can be.
+const ShortsMaxDuration = 3 * time.Minute
+
+// Filter decides which of a channel's videos are downloaded at all. It is
+// applied twice: by yt-dlp through FilterArgs, and to the .info.json of
+// every download by Check, in case yt-dlp let something through.
+type Filter struct {
+	MinDuration    time.Duration
+	MaxDuration    time.Duration
+	TitleInclude   *regexp.Regexp
+	TitleExclude   *regexp.Regexp
+	SkipShorts     bool
+	SkipLive       bool
+	SkipPremieres  bool
+	UploadedAfter  time.Time
+	UploadedBefore time.Time
+}
+
+// LoadFilter reads a resolved channel's filter settings.
+func LoadFilter(channel YouTubeDownload, now time.Time) (Filter, error) {
+	var f Filter
+	var err error
+
+	durations := []struct {
+		field   string
+		setting string
+		value   *time.Duration
+	}{
+		{"MinDuration", channel.MinDuration, &f.MinDuration},
+		{"MaxDuration", channel.MaxDuration, &f.MaxDuration},
+	}
+	for _, d := range durations {
+		if d.setting == "" {
+			continue
+		}
+		if *d.value, err = ParseDurationSetting(d.field, d.setting, "90s or 2h"); err != nil {
+			return f, err
+		}
+	}
+
+	patterns := []struct {
+		field   string
+		setting string
+		value   **regexp.Regexp
+	}{
+		{"TitleInclude", channel.TitleInclude, &f.TitleInclude},
+		{"TitleExclude", channel.TitleExclude, &f.TitleExclude},
+	}
+	for _, p := range patterns {
+		if p.setting == "" {
+			continue
+		}
+		if *p.value, err = regexp.Compile(p.setting); err != nil {
+			return f, settingError(p.field, "%v", err)
+		}
+	}
+
+	flags := []struct {
+		field   string
+		setting string
+		value   *bool
+	}{
+		{"SkipShorts", channel.SkipShorts, &f.SkipShorts},
+		{"SkipLive", channel.SkipLive, &f.SkipLive},
+		{"SkipPremieres", channel.SkipPremieres, &f.SkipPremieres},
+	}
+	for _, b := range flags {
+		if b.setting == "" {
+			continue
+		}
+		if *b.value, err = strconv.ParseBool(b.setting); err != nil {
+			return f, settingError(b.field, "%q is not true or false", b.setting)
+		}
+	}
+
+	dates := []struct {
+		field   string
+		setting string
+		value   *time.Time
+	}{
+		{"UploadedAfter", channel.UploadedAfter, &f.UploadedAfter},
+		{"UploadedBefore", channel.UploadedBefore, &f.UploadedBefore},
+	}
+	for _, d := range dates {
+		if d.setting == "" {
+			continue
+		}
+		if *d.value, err = parseFilterDate(d.setting, now); err != nil {
+			return f, settingError(d.field, "%v", err)
+		}
+	}
+	return f, nil
+}
+
+// parseFilterDate reads a date such as 2024-01-31 or 20240131, or an age
+// such as 90d, which counts back from now.
+func parseFilterDate(setting string, now time.Time) (time.Time, error) {
+	for _, layout := range []string{time.DateOnly, "20060102"} {
+		if t, err := time.Parse(layout, setting); err == nil {
+			return t, nil
+		}
+	}
+	if days, ok := strings.CutSuffix(setting, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			y, m, d := now.AddDate(0, 0, -n).Date()
+			return time.Date(y, m, d, 0, 0, 0, 0, time.UTC), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date such as 2024-01-31 or an age such as 90d", setting)
+}
+
+// matchFilterQuote quotes a value for yt-dlp's --match-filter, which splits
+// conditions at & unless it is escaped.
+func matchFilterQuote(value string) string {
+	return "'" + strings.NewReplacer("&", `\&`, "'", `\'`).Replace(value) + "'"
+}
+
+// FilterArgs are the yt-dlp options that apply the filter. Conditions on a
+// value yt-dlp does not know, such as the duration in a flat listing, pass;
+// Check catches those later.
+func (f Filter) FilterArgs() []string {
+	var conditions []string
+	if f.MinDuration > 0 {
+		conditions = append(conditions, fmt.Sprintf("duration>=?%d", int(f.MinDuration.Seconds())))
+	}
+	if f.MaxDuration > 0 {
+		conditions = append(conditions, fmt.Sprintf("duration<=?%d", int(math.Ceil(f.MaxDuration.Seconds()))))
+	}
+	if f.TitleInclude != nil {
+		conditions = append(conditions, "title~="+matchFilterQuote(f.TitleInclude.String()))
+	}
+	if f.TitleExclude != nil {
+		conditions = append(conditions, "title!~="+matchFilterQuote(f.TitleExclude.String()))
+	}
+	if f.SkipLive {
+		conditions = append(conditions, "live_status!=?is_live", "live_status!=?was_live", "live_status!=?post_live")
+	}
+	if f.SkipPremieres {
+		conditions = append(conditions, "live_status!=?is_upcoming")
+	}
+
+	// Repeated --match-filter options are alternatives, so a Short, being
+	// short and upright, takes two: long enough, or not upright
+	var alternatives [][]string
+	if f.SkipShorts {
+		long := fmt.Sprintf("duration>?%d", int(ShortsMaxDuration.Seconds()))
+		alternatives = [][]string{append(append([]string{}, conditions...), long), append(append([]string{}, conditions...), "aspect_ratio>=?1")}
+	} else if len(conditions) > 0 {
+		alternatives = [][]string{conditions}
+	}
+
+	var args []string
+	for _, a := range alternatives {
+		args = append(args, "--match-filter", strings.Join(a, " & "))
+	}
+	if f.UploadedAfter.IsZero() == false {
+		args = append(args, "--dateafter", f.UploadedAfter.Format("20060102"))
+	}
+	if f.UploadedBefore.IsZero() == false {
+		args = append(args, "--datebefore", f.UploadedBefore.Format("20060102"))
+	}
+	return args
+}
+
+// Check tests a video's .info.json against the filter, returning why it is
+// filtered out, or "" when it may stay.
+func (f Filter) Check(info map[string]any) string {
+	number := func(key string) (float64, bool) {
+		n, ok := info[key].(float64)
+		return n, ok
+	}
+	text := func(key string) string {
+		s, _ := info[key].(string)
+		return s
+	}
+
+	duration, known := number("duration")
+	if known && f.MinDuration > 0 && duration < f.MinDuration.Seconds() {
+		return "shorter than MinDuration"
+	}
+	if known && f.MaxDuration > 0 && duration > f.MaxDuration.Seconds() {
+		return "longer than MaxDuration"
+	}
+	if f.TitleInclude != nil && f.TitleInclude.MatchString(text("title")) == false {
+		return "title does not match TitleInclude"
+	}
+	if f.TitleExclude != nil && f.TitleExclude.MatchString(text("title")) {
+		return "title matches TitleExclude"
+	}
+
+	if f.SkipShorts {
+		width, _ := number("width")
+		height, _ := number("height")
+		upright := height > width
+		if strings.Contains(text("webpage_url"), "/shorts/") || (known && duration <= ShortsMaxDuration.Seconds() && upright) {
+			return "a Short"
+		}
+	}
+
+	live := text("live_status")
+	if f.SkipLive && contains([]string{"is_live", "was_live", "post_live"}, live) {
+		return "a livestream"
+	}
+	if f.SkipPremieres && live == "is_upcoming" {
+		return "a premiere that has not aired"
+	}
+
+	uploaded := parseUploadDate(text("upload_date"))
+	if uploaded.IsZero() == false {
+		if f.UploadedAfter.IsZero() == false && uploaded.Before(f.UploadedAfter) {
+			return "uploaded before UploadedAfter"
+		}
+		if f.UploadedBefore.IsZero() == false && uploaded.After(f.UploadedBefore) {
+			return "uploaded after UploadedBefore"
+		}
+	}
+	return ""
+}
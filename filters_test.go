@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadFilter(t *testing.T) {
+	now := time.Date(2026, 10, 19, 15, 30, 0, 0, time.UTC)
+	channel := YouTubeDownload{MinDuration: "90s", MaxDuration: "2h", TitleExclude: "(?i)trailer", SkipShorts: "true", UploadedAfter: "30d", UploadedBefore: "20261001"}
+	f, err := LoadFilter(channel, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.MinDuration != 90*time.Second || f.MaxDuration != 2*time.Hour || f.TitleExclude == nil || f.SkipShorts == false {
+		t.Errorf("LoadFilter = %+v", f)
+	}
+	if want := time.Date(2026, 9, 19, 0, 0, 0, 0, time.UTC); f.UploadedAfter.Equal(want) == false {
+		t.Errorf("UploadedAfter = %s, want %s", f.UploadedAfter, want)
+	}
+	if want := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC); f.UploadedBefore.Equal(want) == false {
+		t.Errorf("UploadedBefore = %s, want %s", f.UploadedBefore, want)
+	}
+
+	invalid := map[string]YouTubeDownload{
+		"MinDuration":   {MinDuration: "-5s"},
+		"TitleInclude":  {TitleInclude: "("},
+		"SkipLive":      {SkipLive: "sometimes"},
+		"UploadedAfter": {UploadedAfter: "last week"},
+	}
+	for field, channel := range invalid {
+		var setting *SettingError
+		if _, err := LoadFilter(channel, now); errors.As(err, &setting) == false || setting.Field != field {
+			t.Errorf("LoadFilter(%+v) = %v, want a SettingError for %s", channel, err, field)
+		}
+	}
+}
+
+func TestFilterArgs(t *testing.T) {
+	f, err := LoadFilter(YouTubeDownload{MinDuration: "90s", TitleInclude: "Q&A", SkipShorts: "true", SkipPremieres: "true", UploadedAfter: "2024-01-31"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"--match-filter", `duration>=?90 & title~='Q\&A' & live_status!=?is_upcoming & duration>?180`,
+		"--match-filter", `duration>=?90 & title~='Q\&A' & live_status!=?is_upcoming & aspect_ratio>=?1`,
+		"--dateafter", "20240131",
+	}
+	if got := f.FilterArgs(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("FilterArgs =\n%q\nwant\n%q", got, want)
+	}
+	if got := (Filter{}).FilterArgs(); len(got) != 0 {
+		t.Errorf("FilterArgs of no filter = %q, want none", got)
+	}
+}
+
+func TestFilterCheck(t *testing.T) {
+	f, err := LoadFilter(YouTubeDownload{MinDuration: "60s", MaxDuration: "1h", TitleExclude: "(?i)trailer", SkipShorts: "true", SkipLive: "true", UploadedAfter: "2024-01-01"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		info map[string]any
+		want string
+	}{
+		{map[string]any{"title": "Episode", "duration": 600.0, "upload_date": "20240601"}, ""},
+		// Nothing known about it, so nothing to hold against it
+		{map[string]any{}, ""},
+		{map[string]any{"duration": 30.0}, "shorter than MinDuration"},
+		{map[string]any{"duration": 7200.0}, "longer than MaxDuration"},
+		{map[string]any{"title": "Official Trailer", "duration": 600.0}, "title matches TitleExclude"},
+		{map[string]any{"duration": 120.0, "width": 1080.0, "height": 1920.0}, "a Short"},
+		{map[string]any{"duration": 120.0, "width": 1920.0, "height": 1080.0}, ""},
+		{map[string]any{"webpage_url": "https://www.youtube.com/shorts/abc"}, "a Short"},
+		{map[string]any{"live_status": "was_live"}, "a livestream"},
+		{map[string]any{"upload_date": "20231231"}, "uploaded before UploadedAfter"},
+	}
+	for _, tt := range tests {
+		if got := f.Check(tt.info); got != tt.want {
+			t.Errorf("Check(%v) = %q, want %q", tt.info, got, tt.want)
+		}
+	}
+}
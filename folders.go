@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const (
+	DefaultFileMode   os.FileMode = 0644
+	DefaultFolderMode os.FileMode = 0755
+)
+
+// Ownership is how files and folders the tool creates are set up. UID and
+// GID are -1 when ownership is left alone.
+type Ownership struct {
+	FileMode   os.FileMode
+	FolderMode os.FileMode
+	UID        int
+	GID        int
+}
+
+// LoadOwnership reads FileMode, FolderMode, PUID and PGID from the settings.
+func LoadOwnership(s settings) (Ownership, error) {
+	o := Ownership{FileMode: DefaultFileMode, FolderMode: DefaultFolderMode, UID: -1, GID: -1}
+
+	var err error
+	if s.FileMode != "" {
+		if o.FileMode, err = parseFileMode(s.FileMode); err != nil {
+			return o, settingError("FileMode", "%v", err)
+		}
+	}
+	if s.FolderMode != "" {
+		if o.FolderMode, err = parseFileMode(s.FolderMode); err != nil {
+			return o, settingError("FolderMode", "%v", err)
+		}
+	}
+
+	puid, pgid := s.PUID, s.PGID
+	if puid == "" {
+		puid = os.Getenv("PUID")
+	}
+	if pgid == "" {
+		pgid = os.Getenv("PGID")
+	}
+	if puid != "" {
+		if o.UID, err = parseID(puid); err != nil {
+			return o, settingError("PUID", "%v", err)
+		}
+	}
+	if pgid != "" {
+		if o.GID, err = parseID(pgid); err != nil {
+			return o, settingError("PGID", "%v", err)
+		}
+	}
+	return o, nil
+}
+
+func parseFileMode(mode string) (os.FileMode, error) {
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || m > 0777 {
+		return 0, fmt.Errorf("%q is not an octal permission such as 0644", mode)
+	}
+	return os.FileMode(m), nil
+}
+
+func parseID(id string) (int, error) {
+	n, err := strconv.Atoi(id)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a numeric user or group ID", id)
+	}
+	return n, nil
+}
+
+// setup gives a newly created path its permissions and owner.
+func (o Ownership) setup(path string, mode os.FileMode) error {
+	if err := os.Chmod(path, mode); err != nil {
+		return err
+	}
+	if o.UID >= 0 || o.GID >= 0 {
+		if err := os.Chown(path, o.UID, o.GID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MkdirAll creates dir and any missing parents. Only the folders it creates
+// get FolderMode and the owner; existing ones are left as they are.
+func (o Ownership) MkdirAll(dir string) error {
+	dir = filepath.Clean(dir)
+	if isDir(dir) {
+		return nil
+	}
+
+	if parent := filepath.Dir(dir); parent != dir {
+		if err := o.MkdirAll(parent); err != nil {
+			return err
+		}
+	}
+	if err := os.Mkdir(dir, o.FolderMode); err != nil {
+		if os.IsExist(err) {
+			return nil
+		}
+		return err
+	}
+	return o.setup(dir, o.FolderMode)
+}
+
+// CreateFile creates an empty file, and its folder, when it does not exist.
+func (o Ownership) CreateFile(path string) error {
+	if IsValid(path) {
+		return nil
+	}
+	if err := o.MkdirAll(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, o.FileMode)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return o.setup(path, o.FileMode)
+}
+
+// PrepareChannel creates the ChannelID/Season_1 folder and the
+// DownloadArchive file of a resolved channel if they are missing.
+func PrepareChannel(o Ownership, channel YouTubeDownload) error {
+	if err := o.MkdirAll(channel.MediaFolder + channel.ChannelID + "/Season_1"); err != nil {
+		return err
+	}
+	return o.CreateFile(channel.DownloadArchive)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"html"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+const DefaultFailureAlertWindow = 24 * time.Hour
+
+// FailureAlertWindow parses the FailureAlertWindow setting, falling back to
+// DefaultFailureAlertWindow when it is empty or invalid.
+func FailureAlertWindow(setting string) time.Duration {
+	if setting == "" {
+		return DefaultFailureAlertWindow
+	}
+
+	window, err := time.ParseDuration(setting)
+	if err != nil || window <= 0 {
+		slog.Warn("FailureAlertWindow not valid, using default", "phase", "config", "setting", setting, "default", DefaultFailureAlertWindow.String())
+		return DefaultFailureAlertWindow
+	}
+	return window
+}
+
+// ReportChannelHealth records the outcome of a channel run and sends a failure
+// or recovery notification when one is due. A channel that keeps failing with
+// the same class only alerts again once window has passed.
+func ReportChannelHealth(ctx context.Context, notifier *Notifier, window time.Duration, AppToken string, UserToken string, Priority string, Sound string, pName string, pChannelID string, runErr error) {
+	notifier.State.Lock()
+	alert := recordChannelHealth(notifier, window, AppToken, UserToken, Priority, Sound, pName, pChannelID, runErr)
+	notifier.State.Unlock()
+
+	if alert != nil {
+		notifier.Send(ctx, *alert)
+	}
+}
+
+// recordChannelHealth updates the channel's health in State, which must be
+// locked, and returns the notification to send, if any.
+func recordChannelHealth(notifier *Notifier, window time.Duration, AppToken string, UserToken string, Priority string, Sound string, pName string, pChannelID string, runErr error) *Notification {
+	state := notifier.State
+	now := time.Now()
+	health, failing := state.ChannelHealth[pChannelID]
+
+	// ~~~~~~~~~~~~~~~~~ Recovered ~~~~~~~~~~~~~~~~~~~
+
+	if runErr == nil {
+		if failing {
+			slog.Info("channel recovered", "channel", pName, "phase", "health", "failing_since", health.FirstFailure)
+			delete(state.ChannelHealth, pChannelID)
+
+			if health.LastAlert.IsZero() == false {
+				return &Notification{
+					Channel:   pName,
+					AppToken:  AppToken,
+					UserToken: UserToken,
+					Title:     "YouTube Download Recovered (" + pName + ")",
+					Summary:   pName + ": recovered",
+					Body:      "<html><body>" + html.EscapeString(pName) + " is downloading again after " + now.Sub(health.FirstFailure).Round(time.Minute).String() + " and " + strconv.Itoa(health.Failures) + " failed run(s).</body></html>",
+					Priority:  Priority,
+					Sound:     Sound,
+				}
+			}
+		}
+		return nil
+	}
+
+	// ~~~~~~~~~~~~~~~~~~ Failed ~~~~~~~~~~~~~~~~~~~~~
+
+	class := FailureUnknown
+	detail := runErr.Error()
+	var ytErr *YTDLPError
+	if errors.As(runErr, &ytErr) {
+		class = ytErr.Class
+		detail = ErrorLines(ytErr.Stderr)
+	}
+
+	if failing == false {
+		health = &ChannelHealth{Name: pName, FirstFailure: now}
+		state.ChannelHealth[pChannelID] = health
+	}
+
+	classChanged := health.Class != class
+	health.Class = class
+	health.LastError = detail
+	health.LastFailure = now
+	health.Failures++
+
+	slog.Warn("channel failing", "channel", pName, "phase", "health", "class", class, "failures", health.Failures)
+
+	if classChanged == false && now.Sub(health.LastAlert) < window {
+		slog.Info("failure alert already sent, not notifying again", "channel", pName, "phase", "health", "last_alert", health.LastAlert)
+		return nil
+	}
+
+	health.LastAlert = now
+	return &Notification{
+		Channel:   pName,
+		AppToken:  AppToken,
+		UserToken: UserToken,
+		Title:     "YouTube Download Failed (" + pName + ")",
+		Summary:   pName + ": failing (" + string(class) + ")",
+		Body:      "<html><body><b>" + html.EscapeString(string(class)) + "</b><br />Channel: " + html.EscapeString(pName) + " (" + html.EscapeString(pChannelID) + ")<br />Failing since: " + health.FirstFailure.In(notifier.Location).Format(time.RFC1123) + "<br /><br />--------------------------------------------<br /><br />" + html.EscapeString(detail) + "</body></html>",
+		Priority:  Priority,
+		Sound:     Sound,
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "image/gif"
+	_ "image/png"
+)
+
+// PushoverAttachmentLimit is Pushover's maximum attachment size.
+const PushoverAttachmentLimit = 2621440
+
+// attachmentSides are the longest-side sizes tried, largest first, when an
+// image has to be shrunk to fit under PushoverAttachmentLimit.
+var attachmentSides = []int{1920, 1280, 960, 640}
+
+// PushoverAttachment reads an episode image and returns it ready to upload,
+// re-encoding it as a smaller JPEG in memory when it is over the limit.
+func PushoverAttachment(fname string) ([]byte, string, error) {
+	content, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(content) <= PushoverAttachmentLimit {
+		return content, filepath.Base(fname), nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, "", fmt.Errorf("%s is %d bytes and cannot be shrunk: %w", fname, len(content), err)
+	}
+
+	jpgname := strings.TrimSuffix(filepath.Base(fname), filepath.Ext(fname)) + ".jpg"
+	for _, side := range attachmentSides {
+		for _, quality := range []int{85, 70} {
+			var out bytes.Buffer
+			if err := jpeg.Encode(&out, ShrinkImage(img, side), &jpeg.Options{Quality: quality}); err != nil {
+				return nil, "", err
+			}
+			if out.Len() <= PushoverAttachmentLimit {
+				return out.Bytes(), jpgname, nil
+			}
+		}
+	}
+	return nil, "", fmt.Errorf("%s could not be shrunk below %d bytes", fname, PushoverAttachmentLimit)
+}
+
+// ShrinkImage scales img down so its longest side is at most maxSide, averaging
+// the source pixels behind each destination pixel. Smaller images are
+// returned unchanged.
+func ShrinkImage(img image.Image, maxSide int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= maxSide && h <= maxSide {
+		return img
+	}
+
+	dw, dh := maxSide, h*maxSide/w
+	if h > w {
+		dw, dh = w*maxSide/h, maxSide
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		sy0 := bounds.Min.Y + y*h/dh
+		sy1 := bounds.Min.Y + (y+1)*h/dh
+		for x := 0; x < dw; x++ {
+			sx0 := bounds.Min.X + x*w/dw
+			sx1 := bounds.Min.X + (x+1)*w/dw
+
+			var r, g, b, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			if n == 0 {
+				continue
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
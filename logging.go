@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const redacted = "[REDACTED]"
+
+// minSecretLength stops a short or placeholder value from redacting half the
+// log.
+const minSecretLength = 4
+
+var secrets struct {
+	sync.RWMutex
+	values []string
+}
+
+// RegisterSecret adds a value that must never appear in the logs.
+func RegisterSecret(secret string) {
+	secret = strings.TrimSpace(secret)
+	if len(secret) < minSecretLength {
+		return
+	}
+
+	secrets.Lock()
+	defer secrets.Unlock()
+	for _, s := range secrets.values {
+		if s == secret {
+			return
+		}
+	}
+	secrets.values = append(secrets.values, secret)
+	// Longest first, so a secret containing another is replaced whole
+	sort.Slice(secrets.values, func(i, j int) bool { return len(secrets.values[i]) > len(secrets.values[j]) })
+}
+
+// RegisterSettingsSecrets registers every secret in the settings. Cookies
+// file paths count as secrets too, as does the password of a Proxy URL.
+func RegisterSettingsSecrets(s settings) {
+	RegisterSecret(s.PushoverUserToken)
+	RegisterSecret(s.Cookies)
+	RegisterSecret(proxyPassword(s.Proxy))
+	RegisterSecret(s.Defaults.PushoverUserToken)
+	RegisterSecret(s.Defaults.PushoverAppToken)
+	RegisterSecret(s.Defaults.Cookies)
+	RegisterSecret(proxyPassword(s.Defaults.Proxy))
+	for _, p := range s.PodcastDownload {
+		RegisterSecret(p.PushoverAppToken)
+		RegisterSecret(p.PushoverUserToken)
+		RegisterSecret(p.Cookies)
+		RegisterSecret(proxyPassword(p.Proxy))
+	}
+}
+
+// Redact replaces every registered secret in s.
+func Redact(s string) string {
+	secrets.RLock()
+	defer secrets.RUnlock()
+	for _, secret := range secrets.values {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	return s
+}
+
+// RedactWriter redacts secrets from everything written through it. Output is
+// passed on a line at a time (yt-dlp's progress lines end in \r) so a secret
+// split across two writes is still caught; call Flush for the last partial
+// line.
+type RedactWriter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	buf []byte
+}
+
+func NewRedactWriter(w io.Writer) *RedactWriter {
+	return &RedactWriter{w: w}
+}
+
+func (r *RedactWriter) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.buf = append(r.buf, p...)
+	for {
+		i := bytes.IndexAny(r.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		if _, err := io.WriteString(r.w, Redact(string(r.buf[:i+1]))); err != nil {
+			return len(p), err
+		}
+		r.buf = r.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes out any buffered partial line.
+func (r *RedactWriter) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.buf) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(r.w, Redact(string(r.buf)))
+	r.buf = nil
+	return err
+}
+
+// logOutput is where every log record ends up, with secrets removed.
+var logOutput = NewRedactWriter(os.Stderr)
+
+// ParseLogLevel turns the LogLevel setting into a slog.Level; empty is info.
+func ParseLogLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	if level == "" {
+		return slog.LevelInfo, nil
+	}
+	err := l.UnmarshalText([]byte(level))
+	return l, err
+}
+
+// SetupLogging installs the default slog logger for the LogLevel and
+// LogFormat settings. Invalid settings fall back to info and text, and the
+// error is returned so it can be reported once logging works.
+func SetupLogging(level string, format string) error {
+	var errs []error
+
+	l, err := ParseLogLevel(level)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("LogLevel %q: %w", level, err))
+		l = slog.LevelInfo
+	}
+
+	opts := &slog.HandlerOptions{Level: l}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "", "text":
+		handler = slog.NewTextHandler(logOutput, opts)
+	case "json":
+		handler = slog.NewJSONHandler(logOutput, opts)
+	default:
+		errs = append(errs, fmt.Errorf("LogFormat %q is not text or json", format))
+		handler = slog.NewTextHandler(logOutput, opts)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return errors.Join(errs...)
+}
+
+// Fatal logs at error level and exits, the slog version of log.Fatal.
+func Fatal(logger *slog.Logger, msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
+
+// LogWriter turns each line written to it into a log record, so output from
+// yt-dlp keeps the channel and video attributes and stays valid JSON. Lines
+// starting with ERROR: or WARNING: keep their level; everything else is debug.
+type LogWriter struct {
+	mu     sync.Mutex
+	logger *slog.Logger
+	buf    []byte
+	// Intercept, when set, sees every line first and returns true for
+	// lines it has dealt with, which are then not logged.
+	Intercept func(line string) bool
+}
+
+func NewLogWriter(logger *slog.Logger) *LogWriter {
+	return &LogWriter{logger: logger}
+}
+
+func (lw *LogWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	lw.buf = append(lw.buf, p...)
+	for {
+		i := bytes.IndexAny(lw.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		lw.emit(string(lw.buf[:i]))
+		lw.buf = lw.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush logs any buffered partial line.
+func (lw *LogWriter) Flush() {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	lw.emit(string(lw.buf))
+	lw.buf = nil
+}
+
+func (lw *LogWriter) emit(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+	if lw.Intercept != nil && lw.Intercept(line) {
+		return
+	}
+
+	level := slog.LevelDebug
+	switch {
+	case strings.HasPrefix(line, "ERROR:"):
+		level = slog.LevelError
+	case strings.HasPrefix(line, "WARNING:"):
+		level = slog.LevelWarn
+	}
+	lw.logger.Log(context.Background(), level, line)
+}
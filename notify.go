@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Notification is a single message for the Pushover backend. It is stored in
+// the outbox until it has been delivered. Summary is the one line used for it
+// in a digest.
+type Notification struct {
+	Channel   string `json:"Channel"`
+	AppToken  string `json:"AppToken"`
+	UserToken string `json:"UserToken"`
+	Title     string `json:"Title"`
+	Summary   string `json:"Summary,omitempty"`
+	Body      string `json:"Body"`
+	// Attachment is the path of an image already on disk, normally the
+	// episode artwork saved next to the video.
+	Attachment string    `json:"Attachment,omitempty"`
+	URL        string    `json:"URL,omitempty"`
+	Priority   string    `json:"Priority,omitempty"`
+	Sound      string    `json:"Sound,omitempty"`
+	Created    time.Time `json:"Created"`
+}
+
+// HighPriority reports whether the notification uses Pushover priority 1 or 2,
+// which is delivered even during quiet hours.
+func (n Notification) HighPriority() bool {
+	priority, err := strconv.Atoi(n.Priority)
+	return err == nil && priority >= 1
+}
+
+// QuietHours is a daily window, in the configured TimeZone, during which
+// notifications are held back and later sent as a digest. Start and End are
+// "HH:MM"; a window whose End is before its Start runs over midnight.
+type QuietHours struct {
+	Start string `xml:"Start"`
+	End   string `xml:"End"`
+}
+
+func parseClock(clock string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(clock))
+	if err != nil {
+		return 0, fmt.Errorf("time of day %q is not HH:MM", clock)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains reports whether t, already in the right location, falls inside the
+// window.
+func (q QuietHours) Contains(t time.Time) (bool, error) {
+	start, err := parseClock(q.Start)
+	if err != nil {
+		return false, err
+	}
+	end, err := parseClock(q.End)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if start <= end {
+		return now >= start && now < end, nil
+	}
+	return now >= start || now < end, nil
+}
+
+// Notifier delivers notifications through the outbox in the Config folder,
+// recording what has been sent in State.
+type Notifier struct {
+	Config     string
+	Location   *time.Location
+	QuietHours []QuietHours
+	State      *State
+
+	delivering sync.Mutex
+}
+
+// LoadLocation resolves the TimeZone setting, defaulting to the local zone of
+// the container (TZ / /etc/localtime).
+func LoadLocation(TimeZone string) *time.Location {
+	if TimeZone == "" {
+		return time.Local
+	}
+
+	location, err := time.LoadLocation(TimeZone)
+	if err != nil {
+		slog.Warn("TimeZone not valid, using local time", "phase", "config", "error", err)
+		return time.Local
+	}
+	return location
+}
+
+// Quiet reports whether t falls in any configured quiet hours window.
+func (nf *Notifier) Quiet(t time.Time) bool {
+	local := t.In(nf.Location)
+	for _, q := range nf.QuietHours {
+		quiet, err := q.Contains(local)
+		if err != nil {
+			slog.Warn("QuietHours not valid, ignoring", "phase", "config", "error", err)
+			continue
+		}
+		if quiet {
+			return true
+		}
+	}
+	return false
+}
+
+// Send writes n to the outbox and tries to deliver it straight away. During
+// quiet hours, notifications that are not high priority are held back for the
+// digest.
+func (nf *Notifier) Send(ctx context.Context, n Notification) {
+	if n.Created.IsZero() {
+		n.Created = time.Now()
+	}
+
+	entry := &OutboxEntry{ID: newOutboxID(n.Created), Notification: n}
+	if nf.Quiet(n.Created) && n.HighPriority() == false {
+		slog.Info("quiet hours, queueing notification", "channel", n.Channel, "phase", "notify", "title", n.Title)
+		entry.Quiet = true
+	}
+
+	if err := entry.Write(nf.Config); err != nil {
+		slog.Error("writing outbox file failed, sending directly", "channel", n.Channel, "phase", "notify", "error", err)
+		if err := NotifyPushover(ctx, n); err != nil {
+			slog.Error("notification lost", "channel", n.Channel, "phase", "notify", "title", n.Title, "error", err)
+		}
+		return
+	}
+
+	nf.Deliver(ctx)
+}
+
+// Digest summarises several queued notifications into a single message. The
+// digest uses the highest priority and the sound of the first notification.
+func Digest(queued []Notification, location *time.Location) Notification {
+	digest := Notification{
+		AppToken:  queued[0].AppToken,
+		UserToken: queued[0].UserToken,
+		Title:     "YouTube Downloads (" + strconv.Itoa(len(queued)) + " during quiet hours)",
+		Sound:     queued[0].Sound,
+		Priority:  queued[0].Priority,
+		Created:   time.Now(),
+	}
+
+	var body strings.Builder
+	body.WriteString("<html><body>")
+	for _, n := range queued {
+		if priority, err := strconv.Atoi(n.Priority); err == nil {
+			if current, _ := strconv.Atoi(digest.Priority); priority > current {
+				digest.Priority = n.Priority
+			}
+		}
+		summary := n.Summary
+		if summary == "" {
+			summary = n.Title
+		}
+		body.WriteString(n.Created.In(location).Format("Mon 15:04") + " - " + html.EscapeString(summary) + "<br />")
+	}
+	body.WriteString("</body></html>")
+	digest.Body = body.String()
+
+	return digest
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pushoverServer stands in for Pushover, recording the titles posted to it
+// and answering with status.
+type pushoverServer struct {
+	mu     sync.Mutex
+	titles []string
+	status int
+}
+
+func newPushoverServer(t *testing.T) *pushoverServer {
+	t.Helper()
+	p := &pushoverServer{status: http.StatusOK}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.titles = append(p.titles, r.FormValue("title"))
+		w.WriteHeader(p.status)
+	}))
+	t.Cleanup(server.Close)
+
+	savedEndpoint, savedClient := PushoverEndpoint, PushoverClient
+	t.Cleanup(func() { PushoverEndpoint, PushoverClient = savedEndpoint, savedClient })
+	PushoverEndpoint, PushoverClient = server.URL, server.Client()
+	return p
+}
+
+func (p *pushoverServer) posted() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string{}, p.titles...)
+}
+
+func TestQuietHoursContains(t *testing.T) {
+	at := func(clock string) time.Time {
+		t, _ := time.Parse("15:04", clock)
+		return t
+	}
+	tests := []struct {
+		quiet QuietHours
+		clock string
+		want  bool
+	}{
+		{QuietHours{Start: "09:00", End: "17:00"}, "08:59", false},
+		{QuietHours{Start: "09:00", End: "17:00"}, "09:00", true},
+		{QuietHours{Start: "09:00", End: "17:00"}, "17:00", false},
+		{QuietHours{Start: "22:00", End: "07:00"}, "23:30", true},
+		{QuietHours{Start: "22:00", End: "07:00"}, "06:59", true},
+		{QuietHours{Start: "22:00", End: "07:00"}, "12:00", false},
+	}
+	for _, tt := range tests {
+		got, err := tt.quiet.Contains(at(tt.clock))
+		if err != nil || got != tt.want {
+			t.Errorf("%+v.Contains(%s) = %v, %v, want %v", tt.quiet, tt.clock, got, err, tt.want)
+		}
+	}
+
+	if _, err := (QuietHours{Start: "late", End: "07:00"}).Contains(at("12:00")); err == nil {
+		t.Errorf("Contains accepted a Start that is not HH:MM")
+	}
+}
+
+func TestDigest(t *testing.T) {
+	created := time.Date(2026, 10, 19, 23, 15, 0, 0, time.UTC)
+	queued := []Notification{
+		{AppToken: "app", UserToken: "user", Title: "RSS Podcast Downloaded (A)", Summary: "A: <first>", Sound: "pop", Priority: "-1", Created: created},
+		{AppToken: "app", UserToken: "user", Title: "Channel failing (B)", Sound: "siren", Priority: "0", Created: created.Add(time.Hour)},
+	}
+	digest := Digest(queued, time.UTC)
+
+	if digest.Title != "YouTube Downloads (2 during quiet hours)" || digest.Sound != "pop" || digest.Priority != "0" || digest.UserToken != "user" {
+		t.Errorf("digest = %+v, want two queued, the first's sound and the highest priority", digest)
+	}
+	for _, line := range []string{"Mon 23:15 - A: &lt;first&gt;<br />", "Tue 00:15 - Channel failing (B)<br />"} {
+		if strings.Contains(digest.Body, line) == false {
+			t.Errorf("digest body %q does not list %q", digest.Body, line)
+		}
+	}
+}
+
+func TestNotifierHoldsBackDuringQuietHours(t *testing.T) {
+	pushover := newPushoverServer(t)
+	config := t.TempDir() + "/"
+	now := time.Now().UTC()
+	quiet := []QuietHours{{Start: now.Add(-time.Hour).Format("15:04"), End: now.Add(time.Hour).Format("15:04")}}
+	nf := &Notifier{Config: config, Location: time.UTC, QuietHours: quiet, State: (&State{}).init()}
+
+	ctx := context.Background()
+	nf.Send(ctx, Notification{AppToken: "app", UserToken: "user", Title: "first", Summary: "one"})
+	nf.Send(ctx, Notification{AppToken: "app", UserToken: "user", Title: "second", Summary: "two"})
+	nf.Send(ctx, Notification{AppToken: "app", UserToken: "user", Title: "urgent", Priority: "1"})
+	if posted := pushover.posted(); strings.Join(posted, "|") != "urgent" {
+		t.Fatalf("posted %q during quiet hours, want only the high priority one", posted)
+	}
+
+	// Once quiet hours are over the held back ones go out as one digest
+	nf.QuietHours = nil
+	nf.Deliver(ctx)
+	if posted := pushover.posted(); strings.Join(posted, "|") != "urgent|YouTube Downloads (2 during quiet hours)" {
+		t.Errorf("posted %q after quiet hours, want a digest of two", posted)
+	}
+	if entries, _ := ReadOutbox(config); len(entries) != 0 {
+		t.Errorf("outbox still has %d entries", len(entries))
+	}
+}
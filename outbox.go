@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	OutboxRetryBase = time.Minute
+	OutboxRetryMax  = 6 * time.Hour
+	// SentNotificationTTL is how long sent IDs are remembered in State after
+	// their outbox file is gone.
+	SentNotificationTTL = 7 * 24 * time.Hour
+)
+
+// OutboxEntry is a notification waiting in the outbox. Quiet entries were
+// created during quiet hours and are sent as part of a digest.
+type OutboxEntry struct {
+	ID           string       `json:"ID"`
+	Notification Notification `json:"Notification"`
+	Quiet        bool         `json:"Quiet,omitempty"`
+	Attempts     int          `json:"Attempts"`
+	NextAttempt  time.Time    `json:"NextAttempt"`
+	LastError    string       `json:"LastError,omitempty"`
+}
+
+func OutboxPath(Config string) string {
+	return Config + "Outbox/"
+}
+
+func (e *OutboxEntry) path(Config string) string {
+	return OutboxPath(Config) + e.ID + ".json"
+}
+
+func newOutboxID(t time.Time) string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return t.UTC().Format("20060102T150405.000000000") + "-" + hex.EncodeToString(suffix)
+}
+
+// Write stores the entry through a temporary file so a crash never leaves a
+// half written notification in the outbox.
+func (e *OutboxEntry) Write(Config string) error {
+	if err := os.MkdirAll(OutboxPath(Config), 0777); err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := e.path(Config) + ".tmp"
+	if err := os.WriteFile(tmp, content, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, e.path(Config))
+}
+
+// ReadOutbox returns every entry in the outbox, oldest first.
+func ReadOutbox(Config string) ([]*OutboxEntry, error) {
+	files, err := filepath.Glob(OutboxPath(Config) + "*.json")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var entries []*OutboxEntry
+	for _, fname := range files {
+		content, err := os.ReadFile(fname)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := &OutboxEntry{}
+		if err := json.Unmarshal(content, entry); err != nil {
+			slog.Error("skipping unreadable outbox file", "phase", "outbox", "file", fname, "error", err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// OutboxBackoff is the delay before the next delivery attempt after attempts
+// failures: doubling from OutboxRetryBase up to OutboxRetryMax.
+func OutboxBackoff(attempts int) time.Duration {
+	delay := OutboxRetryBase
+	for i := 1; i < attempts && delay < OutboxRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > OutboxRetryMax {
+		delay = OutboxRetryMax
+	}
+	return delay
+}
+
+// markSent records the entries as delivered in State before removing their
+// files, so a crash in between never sends them twice.
+func (nf *Notifier) markSent(entries []*OutboxEntry) {
+	now := time.Now()
+	nf.State.Lock()
+	for _, e := range entries {
+		nf.State.SentNotifications[e.ID] = now
+	}
+	nf.State.Unlock()
+
+	if err := nf.State.Save(nf.Config); err != nil {
+		slog.Error("writing state file failed", "phase", "outbox", "error", err)
+		return
+	}
+
+	for _, e := range entries {
+		if err := os.Remove(e.path(nf.Config)); err != nil && os.IsNotExist(err) == false {
+			slog.Error("removing outbox file failed", "phase", "outbox", "error", err)
+		}
+	}
+}
+
+// markFailed schedules the entries for another attempt.
+func (nf *Notifier) markFailed(entries []*OutboxEntry, sendErr error) {
+	now := time.Now()
+	for _, e := range entries {
+		e.Attempts++
+		e.LastError = sendErr.Error()
+		e.NextAttempt = now.Add(OutboxBackoff(e.Attempts))
+		slog.Warn("notification failed, will retry", "channel", e.Notification.Channel, "phase", "outbox", "id", e.ID, "attempts", e.Attempts, "next_attempt", e.NextAttempt, "error", sendErr)
+
+		if err := e.Write(nf.Config); err != nil {
+			slog.Error("writing outbox file failed", "phase", "outbox", "id", e.ID, "error", err)
+		}
+	}
+}
+
+// Deliver sends every outbox entry that is due. Entries queued during quiet
+// hours wait until they are over and are then combined into one digest per
+// Pushover app and user. Once ctx is done the rest wait for the next run.
+func (nf *Notifier) Deliver(ctx context.Context) {
+	// Channels running side by side must not send the same entry twice
+	nf.delivering.Lock()
+	defer nf.delivering.Unlock()
+
+	entries, err := ReadOutbox(nf.Config)
+	if err != nil {
+		slog.Error("reading outbox failed", "phase", "outbox", "error", err)
+		return
+	}
+
+	now := time.Now()
+	quiet := nf.Quiet(now)
+
+	var order []string
+	digests := map[string][]*OutboxEntry{}
+
+	for _, e := range entries {
+		nf.State.Lock()
+		_, sent := nf.State.SentNotifications[e.ID]
+		nf.State.Unlock()
+		if sent {
+			// Delivered by a run that stopped before removing the file
+			nf.markSent([]*OutboxEntry{e})
+			continue
+		}
+		if now.Before(e.NextAttempt) || ctx.Err() != nil {
+			continue
+		}
+
+		if e.Quiet {
+			if quiet {
+				continue
+			}
+			key := e.Notification.AppToken + "\x00" + e.Notification.UserToken
+			if _, ok := digests[key]; ok == false {
+				order = append(order, key)
+			}
+			digests[key] = append(digests[key], e)
+			continue
+		}
+
+		if err := NotifyPushover(ctx, e.Notification); err != nil {
+			nf.markFailed([]*OutboxEntry{e}, err)
+			continue
+		}
+		nf.markSent([]*OutboxEntry{e})
+	}
+
+	for _, key := range order {
+		if ctx.Err() != nil {
+			break
+		}
+		group := digests[key]
+
+		n := group[0].Notification
+		if len(group) > 1 {
+			queued := make([]Notification, len(group))
+			for i, e := range group {
+				queued[i] = e.Notification
+			}
+			n = Digest(queued, nf.Location)
+		}
+
+		slog.Info("quiet hours over, sending queued notifications", "phase", "outbox", "count", len(group))
+		if err := NotifyPushover(ctx, n); err != nil {
+			nf.markFailed(group, err)
+			continue
+		}
+		nf.markSent(group)
+	}
+
+	nf.State.Lock()
+	nf.State.PruneSent(now)
+	nf.State.Unlock()
+}
+
+// PruneSent forgets sent notification IDs older than SentNotificationTTL.
+func (s *State) PruneSent(now time.Time) {
+	for id, sent := range s.SentNotifications {
+		if now.Sub(sent) > SentNotificationTTL {
+			delete(s.SentNotifications, id)
+		}
+	}
+}
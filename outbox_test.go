@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestOutboxBackoff(t *testing.T) {
+	tests := map[int]time.Duration{
+		0:   time.Minute,
+		1:   time.Minute,
+		2:   2 * time.Minute,
+		3:   4 * time.Minute,
+		9:   256 * time.Minute,
+		10:  OutboxRetryMax,
+		100: OutboxRetryMax,
+	}
+	for attempts, want := range tests {
+		if got := OutboxBackoff(attempts); got != want {
+			t.Errorf("OutboxBackoff(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
+
+func TestDeliverWaitsForNextAttempt(t *testing.T) {
+	pushover := newPushoverServer(t)
+	pushover.status = http.StatusServiceUnavailable
+	config := t.TempDir() + "/"
+	nf := &Notifier{Config: config, Location: time.UTC, State: (&State{}).init()}
+	ctx := context.Background()
+
+	before := time.Now()
+	nf.Send(ctx, Notification{Title: "episode"})
+	entries, err := ReadOutbox(config)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("outbox = %d entries, %v, want the failed notification", len(entries), err)
+	}
+	e := entries[0]
+	if e.Attempts != 1 || e.LastError == "" || e.NextAttempt.Before(before.Add(OutboxRetryBase)) {
+		t.Errorf("failed entry = %+v, want one attempt and the next in %s", e, OutboxRetryBase)
+	}
+
+	// Not due yet, so not tried again
+	pushover.status = http.StatusOK
+	nf.Deliver(ctx)
+	if posted := pushover.posted(); len(posted) != 1 {
+		t.Fatalf("posted %d times before the next attempt was due, want 1", len(posted))
+	}
+
+	e.NextAttempt = time.Now().Add(-time.Second)
+	if err := e.Write(config); err != nil {
+		t.Fatal(err)
+	}
+	nf.Deliver(ctx)
+	if posted := pushover.posted(); len(posted) != 2 {
+		t.Errorf("posted %d times once due, want 2", len(posted))
+	}
+	if entries, _ := ReadOutbox(config); len(entries) != 0 {
+		t.Errorf("outbox still has %d entries after delivery", len(entries))
+	}
+	if _, ok := nf.State.SentNotifications[e.ID]; ok == false {
+		t.Errorf("delivered entry %s not recorded as sent", e.ID)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// yt-dlp is asked to print progress and finished files as JSON lines behind
+// these markers, so they can be told apart from its other output.
+const (
+	progressMarker = "ytplex-progress "
+	resultMarker   = "ytplex-result "
+)
+
+// progressArgs makes yt-dlp report progress a line at a time and print the
+// final path of every file once it has been moved into place.
+var progressArgs = []string{
+	"--newline", "--progress",
+	"--progress-template", "download:" + progressMarker + "%(info.id)s %(progress)j",
+	"--print", "after_move:" + resultMarker + "%(.{id,filepath})j",
+}
+
+// Progress is how far one video's download has got.
+type Progress struct {
+	Channel    string
+	VideoID    string
+	Status     string // downloading, finished or error
+	Percent    float64
+	Downloaded int64
+	Total      int64
+	Speed      float64 // bytes per second
+	ETA        time.Duration
+	Updated    time.Time
+}
+
+// ProgressTracker holds the live progress of every download in flight, for
+// anything that wants to show it.
+type ProgressTracker struct {
+	mu        sync.Mutex
+	current   map[string]Progress
+	listeners []func(Progress)
+}
+
+// LiveProgress tracks every download the process makes.
+var LiveProgress = &ProgressTracker{current: map[string]Progress{}}
+
+// Subscribe calls fn with every progress update. fn must not block.
+func (t *ProgressTracker) Subscribe(fn func(Progress)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.listeners = append(t.listeners, fn)
+}
+
+// Update records p, dropping videos once they have finished or failed.
+func (t *ProgressTracker) Update(p Progress) {
+	t.mu.Lock()
+	key := p.Channel + "/" + p.VideoID
+	if p.Status == "downloading" {
+		t.current[key] = p
+	} else {
+		delete(t.current, key)
+	}
+	listeners := append([]func(Progress){}, t.listeners...)
+	t.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(p)
+	}
+}
+
+// Snapshot lists the downloads in flight.
+func (t *ProgressTracker) Snapshot() []Progress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	list := make([]Progress, 0, len(t.current))
+	for _, p := range t.current {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Channel+list[i].VideoID < list[j].Channel+list[j].VideoID
+	})
+	return list
+}
+
+// ytdlpProgress is yt-dlp's progress dictionary. Unknown values are null.
+type ytdlpProgress struct {
+	Status        string  `json:"status"`
+	Downloaded    float64 `json:"downloaded_bytes"`
+	Total         float64 `json:"total_bytes"`
+	TotalEstimate float64 `json:"total_bytes_estimate"`
+	Speed         float64 `json:"speed"`
+	ETA           float64 `json:"eta"`
+}
+
+// OutputParser picks the progress and result lines out of yt-dlp's output.
+// Progress is logged every ProgressLogStep percent and passed on to
+// LiveProgress; results are collected in Files, by video ID.
+type OutputParser struct {
+	Channel string
+	Logger  *slog.Logger
+
+	mu     sync.Mutex
+	Files  map[string]string
+	logged map[string]float64
+}
+
+// ProgressLogStep is how many percent of a download pass between log lines.
+const ProgressLogStep = 10
+
+func NewOutputParser(channel string, logger *slog.Logger) *OutputParser {
+	return &OutputParser{Channel: channel, Logger: logger, Files: map[string]string{}, logged: map[string]float64{}}
+}
+
+// Line handles one line of output, reporting whether it was a progress or
+// result line. It suits LogWriter.Intercept.
+func (o *OutputParser) Line(line string) bool {
+	switch {
+	case strings.HasPrefix(line, progressMarker):
+		id, raw, _ := strings.Cut(strings.TrimPrefix(line, progressMarker), " ")
+		var yp ytdlpProgress
+		if err := json.Unmarshal([]byte(raw), &yp); err != nil {
+			o.Logger.Debug("unreadable progress line", "line", line, "error", err)
+			return true
+		}
+		o.progress(id, yp)
+		return true
+
+	case strings.HasPrefix(line, resultMarker):
+		var result struct {
+			ID       string `json:"id"`
+			Filepath string `json:"filepath"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, resultMarker)), &result); err != nil {
+			o.Logger.Warn("unreadable result line", "line", line, "error", err)
+			return true
+		}
+		o.mu.Lock()
+		o.Files[result.ID] = result.Filepath
+		o.mu.Unlock()
+		o.Logger.Debug("file saved", "video_id", result.ID, "file", result.Filepath)
+		return true
+	}
+	return false
+}
+
+func (o *OutputParser) progress(id string, yp ytdlpProgress) {
+	p := Progress{
+		Channel:    o.Channel,
+		VideoID:    id,
+		Status:     yp.Status,
+		Downloaded: int64(yp.Downloaded),
+		Total:      int64(yp.Total),
+		Speed:      yp.Speed,
+		ETA:        time.Duration(yp.ETA) * time.Second,
+		Updated:    time.Now(),
+	}
+	if p.Total == 0 {
+		p.Total = int64(yp.TotalEstimate)
+	}
+	if p.Total > 0 {
+		p.Percent = float64(p.Downloaded) * 100 / float64(p.Total)
+	}
+	if p.Status == "finished" {
+		p.Percent = 100
+	}
+	LiveProgress.Update(p)
+
+	// yt-dlp downloads video and audio separately, so a video can pass 100%
+	// twice; log each time a step is crossed or the status changes
+	o.mu.Lock()
+	last, seen := o.logged[id]
+	step := float64(int(p.Percent/ProgressLogStep) * ProgressLogStep)
+	due := seen == false || step != last || p.Status != "downloading"
+	o.logged[id] = step
+	o.mu.Unlock()
+
+	if due {
+		o.Logger.Info("download progress", "video_id", id, "status", p.Status, "percent", fmt.Sprintf("%.1f", p.Percent), "speed", FormatSpeed(p.Speed), "eta", p.ETA.String())
+	}
+}
+
+// FormatSpeed writes a byte rate the way yt-dlp does, such as 2.5MiB/s.
+func FormatSpeed(bytesPerSecond float64) string {
+	units := []string{"B/s", "KiB/s", "MiB/s", "GiB/s"}
+	i := 0
+	for bytesPerSecond >= 1024 && i < len(units)-1 {
+		bytesPerSecond /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f%s", bytesPerSecond, units[i])
+}
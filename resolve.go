@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	channelPathPattern = regexp.MustCompile(`^/channel/(UC[0-9A-Za-z_-]{22})(/|$)`)
+	channelHomePattern = regexp.MustCompile(`^/(channel/[^/]+|@[^/]+|c/[^/]+|user/[^/]+)/?$`)
+	videoPathPattern   = regexp.MustCompile(`^/(shorts|live|embed|v)/([0-9A-Za-z_-]+)/?$`)
+	videoIDPattern     = regexp.MustCompile(`^[0-9A-Za-z_-]+$`)
+)
+
+// VideoIDFromURL reads the video ID out of a watch?v=, youtu.be/, /shorts/,
+// /live/ or /embed/ URL.
+func VideoIDFromURL(raw string) (string, bool) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+
+	id := ""
+	if strings.EqualFold(u.Host, "youtu.be") {
+		id = strings.Trim(u.Path, "/")
+	} else if u.Path == "/watch" {
+		id = u.Query().Get("v")
+	} else if match := videoPathPattern.FindStringSubmatch(u.Path); match != nil {
+		id = match[2]
+	}
+	return id, videoIDPattern.MatchString(id)
+}
+
+// ChannelVideosURL points a channel's home page URL at its Videos tab, as a
+// flat listing of the home page lists the channel's tabs rather than its
+// videos. Other URLs, other tabs included, are left as they are.
+func ChannelVideosURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || channelHomePattern.MatchString(u.Path) == false {
+		return raw
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/videos"
+	return u.String()
+}
+
+// ChannelIDFromURL reads the channel ID out of a youtube.com/channel/UC...
+// URL. Other URLs, such as @handles, have to be looked up.
+func ChannelIDFromURL(raw string) (string, bool) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	match := channelPathPattern.FindStringSubmatch(u.Path)
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
+
+// ResolveChannelIDs works out the channel ID behind every channel's
+// YouTubeURL, asking yt-dlp about @handle, /c/ and /user/ URLs and caching
+// the answers in state. A channel without a ChannelID gets the resolved one;
+// validation reports one that disagrees with its URL. It reports whether the
+// cache changed.
+func ResolveChannelIDs(s *settings, state *State, lookup func(url string) (string, error)) bool {
+	changed := false
+	for i := range s.PodcastDownload {
+		p := &s.PodcastDownload[i]
+		if p.YouTubeURL == "" || validateYouTubeURL(p.YouTubeURL) != nil {
+			continue
+		}
+
+		id, ok := ChannelIDFromURL(p.YouTubeURL)
+		if ok == false {
+			id, ok = state.ChannelIDs[p.YouTubeURL]
+		}
+		if ok == false && p.Disabled == false {
+			slog.Info("resolving channel ID", "phase", "config", "channel", p.Name, "youtube_url", p.YouTubeURL)
+			resolved, err := lookup(p.YouTubeURL)
+			if err != nil {
+				p.resolveErr = err
+				continue
+			}
+			id = resolved
+			state.ChannelIDs[p.YouTubeURL] = id
+			changed = true
+		}
+		if id == "" {
+			continue
+		}
+
+		p.resolvedID = id
+		if p.ChannelID == "" {
+			p.ChannelID = id
+		}
+	}
+	return changed
+}
+
+// LookupChannelID asks yt-dlp for the channel ID behind a URL.
+func LookupChannelID(ctx context.Context, url string) (string, error) {
+	meta, err := ActiveDownloader.ChannelMetadata(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	return meta.ChannelID, nil
+}
+
+// ResolveSettingsChannelIDs resolves channel IDs with the cache kept in the
+// state file of the Config folder. Each lookup is bounded by VideoTimeout.
+func ResolveSettingsChannelIDs(ctx context.Context, s *settings) {
+	state, err := LoadState(s.Config)
+	keep := err == nil && isDir(s.Config)
+	if keep == false {
+		// Resolve anyway, just without a cache to keep
+		state = (&State{}).init()
+	}
+
+	// Validation reports a bad VideoTimeout; lookups keep to the default
+	timeouts, err := LoadTimeouts(*s)
+	if err != nil {
+		timeouts = Timeouts{Video: DefaultVideoTimeout}
+	}
+	lookup := func(url string) (string, error) {
+		ctx, cancel := WithTimeout(ctx, timeouts.Video)
+		defer cancel()
+		return LookupChannelID(ctx, url)
+	}
+
+	if ResolveChannelIDs(s, state, lookup) && keep {
+		if err := state.Save(s.Config); err != nil {
+			slog.Error("writing state file failed", "phase", "state", "error", err)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestChannelVideosURL(t *testing.T) {
+	tests := map[string]string{
+		"https://www.youtube.com/channel/UCrrrrrrrrrrrrrrrrrrrrrr":        "https://www.youtube.com/channel/UCrrrrrrrrrrrrrrrrrrrrrr/videos",
+		"https://www.youtube.com/channel/UCrrrrrrrrrrrrrrrrrrrrrr/":       "https://www.youtube.com/channel/UCrrrrrrrrrrrrrrrrrrrrrr/videos",
+		"https://www.youtube.com/@handle":                                 "https://www.youtube.com/@handle/videos",
+		"https://youtube.com/c/name?x=1":                                  "https://youtube.com/c/name/videos?x=1",
+		"https://www.youtube.com/user/name":                               "https://www.youtube.com/user/name/videos",
+		"https://www.youtube.com/@handle/streams":                         "https://www.youtube.com/@handle/streams",
+		"https://www.youtube.com/channel/UCrrrrrrrrrrrrrrrrrrrrrr/shorts": "https://www.youtube.com/channel/UCrrrrrrrrrrrrrrrrrrrrrr/shorts",
+		"https://www.youtube.com/playlist?list=PL123":                     "https://www.youtube.com/playlist?list=PL123",
+		"https://www.youtube.com/watch?v=abc":                             "https://www.youtube.com/watch?v=abc",
+		"https://youtu.be/abc":                                            "https://youtu.be/abc",
+	}
+	for in, want := range tests {
+		if got := ChannelVideosURL(in); got != want {
+			t.Errorf("ChannelVideosURL(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestVideoIDFromURL(t *testing.T) {
+	tests := map[string]string{
+		"https://www.youtube.com/watch?v=dQw4w9WgXcQ":        "dQw4w9WgXcQ",
+		"https://m.youtube.com/watch?list=PL1&v=dQw4w9WgXcQ": "dQw4w9WgXcQ",
+		"https://youtu.be/dQw4w9WgXcQ?si=abc":                "dQw4w9WgXcQ",
+		"https://www.youtube.com/shorts/dQw4w9WgXcQ":         "dQw4w9WgXcQ",
+		"https://www.youtube.com/live/dQw4w9WgXcQ?feature=x": "dQw4w9WgXcQ",
+		"https://www.youtube.com/embed/dQw4w9WgXcQ":          "dQw4w9WgXcQ",
+		"https://www.youtube.com/@handle":                    "",
+		"https://www.youtube.com/playlist?list=PL123":        "",
+		"https://www.youtube.com/watch":                      "",
+		"https://youtu.be/":                                  "",
+	}
+	for in, want := range tests {
+		got, ok := VideoIDFromURL(in)
+		if got != want || ok != (want != "") {
+			t.Errorf("VideoIDFromURL(%q) = %q, %v, want %q", in, got, ok, want)
+		}
+	}
+}
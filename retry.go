@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultRetryAttempts = 3
+	DefaultRetryBackoff  = 30 * time.Second
+	DefaultRetryBudget   = 10 * time.Minute
+)
+
+// RetryPolicy retries transient yt-dlp failures, such as rate limiting or a
+// dropped connection, waiting Backoff before the second attempt and twice as
+// long before each one after that. Budget caps the waiting a whole run does,
+// across every channel, so a YouTube outage cannot stretch a cron run out
+// until the next one starts.
+type RetryPolicy struct {
+	Attempts int
+	Backoff  time.Duration
+	Budget   time.Duration
+
+	mu    sync.Mutex
+	spent time.Duration
+}
+
+// LoadRetryPolicy reads RetryAttempts, RetryBackoff and RetryBudget.
+func LoadRetryPolicy(s settings) (*RetryPolicy, error) {
+	r := &RetryPolicy{Attempts: DefaultRetryAttempts, Backoff: DefaultRetryBackoff, Budget: DefaultRetryBudget}
+
+	if s.RetryAttempts != "" {
+		attempts, err := strconv.Atoi(s.RetryAttempts)
+		if err != nil || attempts < 1 {
+			return nil, settingError("RetryAttempts", "%q is not a number of attempts of 1 or more", s.RetryAttempts)
+		}
+		r.Attempts = attempts
+	}
+
+	durations := []struct {
+		field   string
+		setting string
+		value   *time.Duration
+	}{
+		{"RetryBackoff", s.RetryBackoff, &r.Backoff},
+		{"RetryBudget", s.RetryBudget, &r.Budget},
+	}
+	for _, d := range durations {
+		if d.setting == "" {
+			continue
+		}
+		value, err := ParseDurationSetting(d.field, d.setting, "30s")
+		if err != nil {
+			return nil, err
+		}
+		*d.value = value
+	}
+	return r, nil
+}
+
+// take spends wait from the budget, reporting false when there is not
+// enough of it left.
+func (r *RetryPolicy) take(wait time.Duration) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.spent+wait > r.Budget {
+		return false
+	}
+	r.spent += wait
+	return true
+}
+
+// Do runs fn until it succeeds, fails with something other than a transient
+// failure, runs out of attempts or the budget is used up, or ctx is done,
+// returning its last error.
+func (r *RetryPolicy) Do(ctx context.Context, logger *slog.Logger, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		class := FailureClassOf(err)
+		if err == nil || class.Transient() == false {
+			return err
+		}
+		if attempt >= r.Attempts {
+			logger.Warn("giving up after retrying", "class", class, "attempts", attempt)
+			return err
+		}
+
+		wait := r.Backoff << (attempt - 1)
+		if r.take(wait) == false {
+			logger.Warn("retry budget used up, not retrying", "class", class, "attempts", attempt, "budget", r.Budget.String())
+			return err
+		}
+		logger.Warn("transient failure, retrying", "class", class, "attempt", attempt, "wait", wait.String(), "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDo(t *testing.T) {
+	transient := &YTDLPError{Class: FailureRateLimited, Err: errors.New("exit status 1")}
+	perVideo := &YTDLPError{Class: FailureUnavailable, Err: errors.New("exit status 1")}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tests := []struct {
+		name     string
+		policy   *RetryPolicy
+		failures []error
+		calls    int
+		spent    time.Duration
+	}{
+		{"success", &RetryPolicy{Attempts: 3, Backoff: time.Millisecond, Budget: time.Second}, nil, 1, 0},
+		{"transient then success", &RetryPolicy{Attempts: 3, Backoff: time.Millisecond, Budget: time.Second}, []error{transient}, 2, time.Millisecond},
+		{"out of attempts", &RetryPolicy{Attempts: 3, Backoff: time.Millisecond, Budget: time.Second}, []error{transient, transient, transient, transient}, 3, 3 * time.Millisecond},
+		{"not transient", &RetryPolicy{Attempts: 3, Backoff: time.Millisecond, Budget: time.Second}, []error{perVideo}, 1, 0},
+		{"not yt-dlp", &RetryPolicy{Attempts: 3, Backoff: time.Millisecond, Budget: time.Second}, []error{errors.New("disk full")}, 1, 0},
+		// Waits of 1ms then 2ms fit the budget; the 4ms after them does not
+		{"budget used up", &RetryPolicy{Attempts: 10, Backoff: time.Millisecond, Budget: 3 * time.Millisecond}, []error{transient, transient, transient, transient}, 3, 3 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		calls := 0
+		err := tt.policy.Do(context.Background(), logger, func() error {
+			calls++
+			if calls <= len(tt.failures) {
+				return tt.failures[calls-1]
+			}
+			return nil
+		})
+		var want error
+		if tt.calls <= len(tt.failures) {
+			want = tt.failures[tt.calls-1]
+		}
+		if calls != tt.calls || err != want {
+			t.Errorf("%s: %d calls returning %v, want %d returning %v", tt.name, calls, err, tt.calls, want)
+		}
+		if tt.policy.spent != tt.spent {
+			t.Errorf("%s: spent %s of the budget, want %s", tt.name, tt.policy.spent, tt.spent)
+		}
+	}
+}
+
+func TestRetryPolicyDoStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := &RetryPolicy{Attempts: 3, Backoff: time.Hour, Budget: 2 * time.Hour}
+	calls := 0
+	err := policy.Do(ctx, slog.New(slog.NewTextHandler(io.Discard, nil)), func() error {
+		calls++
+		cancel()
+		return &YTDLPError{Class: FailureNetwork, Err: errors.New("exit status 1")}
+	})
+	if calls != 1 || FailureClassOf(err) != FailureNetwork {
+		t.Errorf("%d calls returning %v, want one network failure", calls, err)
+	}
+}
+
+func TestLoadRetryPolicy(t *testing.T) {
+	r, err := LoadRetryPolicy(settings{})
+	if err != nil || r.Attempts != DefaultRetryAttempts || r.Backoff != DefaultRetryBackoff || r.Budget != DefaultRetryBudget {
+		t.Errorf("LoadRetryPolicy of no settings = %+v, %v, want the defaults", r, err)
+	}
+	r, err = LoadRetryPolicy(settings{RetryAttempts: "5", RetryBackoff: "1s", RetryBudget: "1m"})
+	if err != nil || r.Attempts != 5 || r.Backoff != time.Second || r.Budget != time.Minute {
+		t.Errorf("LoadRetryPolicy = %+v, %v, want 5 attempts, 1s and 1m", r, err)
+	}
+
+	for _, s := range []settings{{RetryAttempts: "0"}, {RetryAttempts: "many"}, {RetryBackoff: "-1s"}, {RetryBudget: "soon"}} {
+		var setting *SettingError
+		if r, err := LoadRetryPolicy(s); r != nil || errors.As(err, &setting) == false {
+			t.Errorf("LoadRetryPolicy(%+v) = %+v, %v, want no policy and a SettingError", s, r, err)
+		}
+	}
+}
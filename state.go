@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// State is everything the tool has to remember between cron runs. It is kept
+// as a single JSON file in the Config folder, next to the episode counters.
+type State struct {
+	ChannelHealth     map[string]*ChannelHealth `json:"ChannelHealth,omitempty"`
+	SentNotifications map[string]time.Time      `json:"SentNotifications,omitempty"`
+	// ChannelIDs caches the channel ID each @handle, /c/ or /user/ YouTubeURL
+	// resolved to
+	ChannelIDs map[string]string `json:"ChannelIDs,omitempty"`
+	// SkippedVideos are videos that failed for good, such as private or
+	// members-only ones, by video ID. They are not tried again; delete an
+	// entry, or fetch the video, to retry it.
+	SkippedVideos map[string]*SkippedVideo `json:"SkippedVideos,omitempty"`
+	// DeferredVideos are videos left for a later run, outside a download
+	// window, timed out or not out yet, by video ID. They are tried again
+	// even once they have dropped out of the channel's PlaylistItems.
+	DeferredVideos map[string]*DeferredVideo `json:"DeferredVideos,omitempty"`
+	// Backfill is how far each channel's backfill has got, by ChannelID
+	Backfill map[string]*BackfillCursor `json:"Backfill,omitempty"`
+
+	// mu guards the maps while channels run side by side
+	mu sync.Mutex
+}
+
+// SkippedVideo records why a video was skipped.
+type SkippedVideo struct {
+	Channel string       `json:"Channel"`
+	Class   FailureClass `json:"Class"`
+	Error   string       `json:"Error"`
+	Skipped time.Time    `json:"Skipped"`
+}
+
+// DeferredVideo records a video left for a later run and why.
+type DeferredVideo struct {
+	Channel   string    `json:"Channel"`
+	ChannelID string    `json:"ChannelID"`
+	Uploaded  time.Time `json:"Uploaded,omitempty"`
+	Reason    string    `json:"Reason"`
+	Deferred  time.Time `json:"Deferred"`
+}
+
+// ChannelHealth records a channel that is currently failing so that repeated
+// failures only alert once per window and a recovery can be announced.
+type ChannelHealth struct {
+	Name         string       `json:"Name"`
+	Class        FailureClass `json:"Class"`
+	LastError    string       `json:"LastError"`
+	FirstFailure time.Time    `json:"FirstFailure"`
+	LastFailure  time.Time    `json:"LastFailure"`
+	LastAlert    time.Time    `json:"LastAlert"`
+	Failures     int          `json:"Failures"`
+}
+
+func StatePath(Config string) string {
+	return Config + "DownloadYouTubePlexGo_State.json"
+}
+
+// LoadState reads the state file, returning an empty state if it does not
+// exist yet.
+func LoadState(Config string) (*State, error) {
+	state := &State{}
+
+	content, err := os.ReadFile(StatePath(Config))
+	if os.IsNotExist(err) {
+		return state.init(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, state); err != nil {
+		return nil, err
+	}
+	return state.init(), nil
+}
+
+func (s *State) init() *State {
+	if s.ChannelHealth == nil {
+		s.ChannelHealth = map[string]*ChannelHealth{}
+	}
+	if s.SentNotifications == nil {
+		s.SentNotifications = map[string]time.Time{}
+	}
+	if s.ChannelIDs == nil {
+		s.ChannelIDs = map[string]string{}
+	}
+	if s.SkippedVideos == nil {
+		s.SkippedVideos = map[string]*SkippedVideo{}
+	}
+	if s.DeferredVideos == nil {
+		s.DeferredVideos = map[string]*DeferredVideo{}
+	}
+	if s.Backfill == nil {
+		s.Backfill = map[string]*BackfillCursor{}
+	}
+	return s
+}
+
+// Lock must be held to read or change State while channels are running. Save
+// takes it by itself.
+func (s *State) Lock() {
+	s.mu.Lock()
+}
+
+func (s *State) Unlock() {
+	s.mu.Unlock()
+}
+
+// Save writes the state through a temporary file so an interrupted run never
+// leaves a truncated state file behind.
+func (s *State) Save(Config string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := StatePath(Config) + ".tmp"
+	if err := os.WriteFile(tmp, content, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, StatePath(Config))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	DefaultVideoTimeout = 2 * time.Hour
+	// ArtworkTimeout and NotifyTimeout bound a single HTTP request for a
+	// thumbnail or a Pushover notification.
+	ArtworkTimeout = 2 * time.Minute
+	NotifyTimeout  = 30 * time.Second
+	// KillGrace is how long yt-dlp and ffmpeg get to exit after SIGTERM
+	// before they are killed.
+	KillGrace = 10 * time.Second
+)
+
+// Timeouts bound how long a run may take. Video applies to each yt-dlp call,
+// such as downloading one video or listing a channel; Run applies to the
+// whole run. Zero means no limit.
+type Timeouts struct {
+	Video time.Duration
+	Run   time.Duration
+}
+
+// LoadTimeouts reads VideoTimeout and RunTimeout, which default to 2h and no
+// limit.
+func LoadTimeouts(s settings) (Timeouts, error) {
+	t := Timeouts{Video: DefaultVideoTimeout}
+
+	durations := []struct {
+		field   string
+		setting string
+		value   *time.Duration
+	}{
+		{"VideoTimeout", s.VideoTimeout, &t.Video},
+		{"RunTimeout", s.RunTimeout, &t.Run},
+	}
+	for _, d := range durations {
+		if d.setting == "" {
+			continue
+		}
+		value, err := ParseDurationSetting(d.field, d.setting, "2h, or 0 for no limit")
+		if err != nil {
+			return t, err
+		}
+		*d.value = value
+	}
+	return t, nil
+}
+
+// WithTimeout is context.WithTimeout, except that a zero timeout means none.
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,455 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Problem is one thing wrong with the settings. Channel is empty for global
+// settings.
+type Problem struct {
+	Channel string
+	Field   string
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Channel == "" {
+		return p.Field + ": " + p.Message
+	}
+	return p.Channel + ": " + p.Field + ": " + p.Message
+}
+
+// SettingError is a setting that cannot be used, as the Load functions such
+// as LoadTimeouts return it.
+type SettingError struct {
+	Field   string
+	Message string
+}
+
+func (e *SettingError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// settingError makes a SettingError of a formatted message.
+func settingError(field string, format string, args ...any) error {
+	return &SettingError{Field: field, Message: fmt.Sprintf(format, args...)}
+}
+
+// settingMessage drops the setting's name from a SettingError, for problems
+// reported under the field already. Other errors are returned as they are.
+func settingMessage(err error) error {
+	var setting *SettingError
+	if errors.As(err, &setting) {
+		return errors.New(setting.Message)
+	}
+	return err
+}
+
+// ParseDurationSetting reads a duration setting such as "90s" or "2h",
+// refusing negative ones. example goes into the error.
+func ParseDurationSetting(field string, setting string, example string) (time.Duration, error) {
+	d, err := time.ParseDuration(setting)
+	if err != nil || d < 0 {
+		return 0, settingError(field, "%q is not a duration such as %s", setting, example)
+	}
+	return d, nil
+}
+
+// ValidationReport holds every problem found in the settings. Channels is
+// indexed like settings.PodcastDownload.
+type ValidationReport struct {
+	Global   []Problem
+	Channels [][]Problem
+}
+
+// ChannelValid reports whether PodcastDownload i can be run.
+func (r ValidationReport) ChannelValid(i int) bool {
+	return len(r.Global) == 0 && len(r.Channels[i]) == 0
+}
+
+func (r ValidationReport) Problems() []Problem {
+	problems := append([]Problem{}, r.Global...)
+	for _, channel := range r.Channels {
+		problems = append(problems, channel...)
+	}
+	return problems
+}
+
+var (
+	channelIDPattern    = regexp.MustCompile(`^UC[0-9A-Za-z_-]{22}$`)
+	playlistItemPattern = regexp.MustCompile(`^-?\d+(-\d+)?$|^-?\d*:-?\d*(:-?\d+)?$`)
+	// Format codes: YouTube's numeric ones such as 137 or 251-drc, storyboards
+	// such as sb0, and protocol ones such as hls-1080p or dash-2176
+	formatIDPattern     = regexp.MustCompile(`^[0-9]+(-[0-9a-z]+)*$|^sb[0-9]+$|^(hls|dash|http|https|m3u8|rtmp)-[0-9]+p?[0-9]*(-[0-9a-z]+)*$`)
+	formatExtensions    = []string{"mp4", "webm", "m4a", "mp3", "ogg", "opus", "aac", "flac", "wav", "flv", "3gp", "mkv", "mov", "mhtml"}
+	formatFilterPattern = regexp.MustCompile(`^!?[a-z_]+(\s*!?(<=|>=|!=|\^=|\$=|\*=|~=|=|<|>)\??\s*[^\]]+)?$`)
+	mergeFormats        = []string{"mp4", "mkv", "webm", "mov", "avi", "flv"}
+	formatSelectors     = []string{"best", "worst", "bestvideo", "worstvideo", "bestaudio", "worstaudio", "b", "w", "bv", "wv", "ba", "wa", "b*", "w*", "bv*", "wv*", "ba*", "wa*", "all", "mergeall"}
+	youtubeHosts        = []string{"youtube.com", "www.youtube.com", "m.youtube.com", "youtu.be"}
+)
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// ValidateSettings checks the global settings and every PodcastDownload,
+// collecting all problems rather than stopping at the first.
+func ValidateSettings(s settings) ValidationReport {
+	report := ValidationReport{Channels: make([][]Problem, len(s.PodcastDownload))}
+	global := func(field string, format string, args ...any) {
+		report.Global = append(report.Global, Problem{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+	// loaded reports a loader's error, under group when it does not say
+	// which setting is at fault
+	loaded := func(group string, err error) {
+		var setting *SettingError
+		switch {
+		case errors.As(err, &setting):
+			global(setting.Field, "%s", setting.Message)
+		case err != nil:
+			global(group, "%v", err)
+		}
+	}
+
+	// ~~~~~~~~~~~~~~ Global Settings ~~~~~~~~~~~~~~~
+
+	// MediaFolder, PlaylistItems, PushoverUserToken and the yt-dlp settings
+	// from LimitRate on can also be set per channel or in Defaults, so they
+	// are only required once resolved
+	for _, field := range []string{"MediaFolder", "PlaylistItems", "LimitRate", "DownloadWindow", "BacklogWindow", "Cookies", "Proxy", "ExtractorArgs", "ExtraArgs"} {
+		if value := reflect.ValueOf(s).FieldByName(field).String(); value != "" {
+			if err := validateInheritable(field, value); err != nil {
+				global(field, "%v", err)
+			}
+		}
+	}
+
+	if s.Config == "" {
+		global("Config", "is required")
+	} else if isDir(s.Config) == false {
+		global("Config", "folder %q does not exist", s.Config)
+	}
+
+	if s.FailureAlertWindow != "" {
+		if window, err := ParseDurationSetting("FailureAlertWindow", s.FailureAlertWindow, "12h"); err != nil || window == 0 {
+			global("FailureAlertWindow", "%q is not a duration such as 12h", s.FailureAlertWindow)
+		}
+	}
+
+	if s.TimeZone != "" {
+		if _, err := time.LoadLocation(s.TimeZone); err != nil {
+			global("TimeZone", "%v", err)
+		}
+	}
+
+	for i, q := range s.QuietHours {
+		if _, err := q.Contains(time.Now()); err != nil {
+			global("QuietHours["+strconv.Itoa(i)+"]", "%v", err)
+		}
+	}
+
+	_, err := LoadOwnership(s)
+	loaded("Ownership", err)
+	_, err = LoadRetryPolicy(s)
+	loaded("Retry", err)
+	_, err = LoadTimeouts(s)
+	loaded("Timeouts", err)
+	_, err = LoadWorkers(s)
+	loaded("Workers", err)
+
+	if _, err := ParseLogLevel(s.LogLevel); err != nil {
+		global("LogLevel", "%q is not debug, info, warn or error", s.LogLevel)
+	}
+	if s.LogFormat != "" && contains([]string{"text", "json"}, strings.ToLower(s.LogFormat)) == false {
+		global("LogFormat", "%q is not text or json", s.LogFormat)
+	}
+
+	// ~~~~~~~~~~~~~~ Defaults ~~~~~~~~~~~~~~~
+
+	defaults := reflect.ValueOf(s.Defaults)
+	for _, f := range reflect.VisibleFields(defaults.Type()) {
+		if value := defaults.FieldByIndex(f.Index).String(); value != "" {
+			if err := validateInheritable(f.Name, value); err != nil {
+				global("Defaults."+f.Name, "%v", err)
+			}
+		}
+	}
+
+	// ~~~~~~~~~~~~~~ PodcastDownload ~~~~~~~~~~~~~~~
+
+	seenIDs := map[string]string{}
+	for i := range s.PodcastDownload {
+		// Disabled channels are not run, so need not be complete
+		if s.PodcastDownload[i].Disabled {
+			continue
+		}
+		p, sources := ResolveChannel(s, s.PodcastDownload[i])
+		name := p.Name
+		if name == "" {
+			name = "PodcastDownload[" + strconv.Itoa(i) + "]"
+		}
+		channel := func(field string, format string, args ...any) {
+			report.Channels[i] = append(report.Channels[i], Problem{Channel: name, Field: field, Message: fmt.Sprintf(format, args...)})
+		}
+
+		if p.Name == "" {
+			channel("Name", "is required")
+		}
+
+		switch {
+		case p.ChannelID == "" && p.resolveErr != nil:
+			channel("ChannelID", "is not set and could not be looked up from YouTubeURL: %v", p.resolveErr)
+		case p.ChannelID == "":
+			channel("ChannelID", "is required unless YouTubeURL is a channel, @handle, /c/ or /user/ URL")
+		case channelIDPattern.MatchString(p.ChannelID) == false:
+			channel("ChannelID", "%q is not a channel ID (UC followed by 22 characters)", p.ChannelID)
+		case p.resolvedID != "" && p.resolvedID != p.ChannelID:
+			channel("ChannelID", "%q does not match YouTubeURL, which is channel %q", p.ChannelID, p.resolvedID)
+		case seenIDs[p.ChannelID] != "":
+			channel("ChannelID", "%q is also used by %s", p.ChannelID, seenIDs[p.ChannelID])
+		default:
+			seenIDs[p.ChannelID] = name
+		}
+
+		// A missing DownloadArchive is created before the channel runs
+		if isDir(p.DownloadArchive) {
+			channel("DownloadArchive", "%q is a folder, not a file", p.DownloadArchive)
+		}
+
+		if err := validateYouTubeURL(p.YouTubeURL); err != nil {
+			channel("YouTubeURL", "%v", err)
+		}
+
+		// Inherited values were checked where they were set
+		channelValues := reflect.ValueOf(p)
+		for _, f := range reflect.VisibleFields(defaults.Type()) {
+			value := channelValues.FieldByName(f.Name).String()
+			if value == "" {
+				if contains(requiredChannelSettings, f.Name) {
+					channel(f.Name, "is required")
+				}
+				continue
+			}
+			if sources[f.Name] != SourceChannel {
+				continue
+			}
+			if err := validateInheritable(f.Name, value); err != nil {
+				channel(f.Name, "%v", err)
+			}
+		}
+	}
+
+	return report
+}
+
+// requiredChannelSettings must have a value once a channel is resolved.
+var requiredChannelSettings = []string{"PlaylistItems", "MediaFolder", "FileFormat", "FileQuality", "PushoverUserToken"}
+
+// validateInheritable checks a setting that a channel can set or inherit
+// from Defaults or the global settings.
+func validateInheritable(field string, value string) error {
+	switch field {
+	case "PlaylistItems":
+		if ValidPlaylistItems(value) == false {
+			return fmt.Errorf("%q is not a yt-dlp --playlist-items range such as 1-5 or 1:10", value)
+		}
+	case "MediaFolder":
+		if isDir(value) == false {
+			return fmt.Errorf("folder %q does not exist", value)
+		}
+	case "FileFormat":
+		if contains(mergeFormats, value) == false {
+			return fmt.Errorf("%q is not one of %s", value, strings.Join(mergeFormats, ", "))
+		}
+	case "FileQuality":
+		return ValidateFormatSelector(value)
+	case "Retention":
+		_, err := ParseRetention(value)
+		return err
+	case "LimitRate":
+		if limitRatePattern.MatchString(value) == false {
+			return fmt.Errorf("%q is not a yt-dlp --limit-rate such as 500K or 2M", value)
+		}
+	case "DownloadWindow", "BacklogWindow":
+		_, err := ParseWindows(value)
+		return err
+	case "Cookies":
+		if IsValid(value) == false || isDir(value) {
+			return fmt.Errorf("cookies file %q does not exist", value)
+		}
+	case "Proxy":
+		return ValidateProxy(value)
+	case "ExtractorArgs":
+		return ValidateExtractorArgs(value)
+	case "ExtraArgs":
+		return ValidateExtraArgs(value)
+	case "Backfill", "BackfillBatch":
+		var channel YouTubeDownload
+		reflect.ValueOf(&channel).Elem().FieldByName(field).SetString(value)
+		if _, err := LoadBackfill(channel); err != nil {
+			return settingMessage(err)
+		}
+	case "MinDuration", "MaxDuration", "TitleInclude", "TitleExclude", "SkipShorts", "SkipLive", "SkipPremieres", "UploadedAfter", "UploadedBefore":
+		var channel YouTubeDownload
+		reflect.ValueOf(&channel).Elem().FieldByName(field).SetString(value)
+		if _, err := LoadFilter(channel, time.Now()); err != nil {
+			return settingMessage(err)
+		}
+	case "PushoverPriority":
+		if priority, err := strconv.Atoi(value); err != nil || priority < -2 || priority > 2 {
+			return fmt.Errorf("%q is not a Pushover priority from -2 to 2", value)
+		}
+	}
+	return nil
+}
+
+// ValidPlaylistItems checks the yt-dlp --playlist-items syntax: comma
+// separated indexes, ranges (1-5) and slices (1:10:2).
+func ValidPlaylistItems(items string) bool {
+	for _, item := range strings.Split(items, ",") {
+		if playlistItemPattern.MatchString(strings.TrimSpace(item)) == false {
+			return false
+		}
+	}
+	return true
+}
+
+func validateYouTubeURL(raw string) error {
+	if raw == "" {
+		return fmt.Errorf("is required")
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("%q is not a URL: %v", raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%q is not an http or https URL", raw)
+	}
+	if contains(youtubeHosts, strings.ToLower(u.Host)) == false {
+		return fmt.Errorf("%q is not a YouTube URL", raw)
+	}
+	return nil
+}
+
+// ValidateFormatSelector checks a yt-dlp --format selector such as
+// "bestvideo[height<=1080]+bestaudio/best". Every selector must be one of
+// yt-dlp's named selectors, a format code such as 137 or hls-1080p, or an
+// extension such as mp4, and every [filter] must be well formed.
+func ValidateFormatSelector(selector string) error {
+	if strings.TrimSpace(selector) == "" {
+		return fmt.Errorf("is required")
+	}
+
+	atoms := strings.FieldsFunc(selector, func(r rune) bool {
+		return r == '/' || r == ',' || r == '+' || r == '(' || r == ')'
+	})
+	if len(atoms) == 0 {
+		return fmt.Errorf("%q has no format selectors", selector)
+	}
+
+	for _, atom := range atoms {
+		atom = strings.TrimSpace(atom)
+
+		base := atom
+		filters := ""
+		if i := strings.Index(atom, "["); i >= 0 {
+			base, filters = atom[:i], atom[i:]
+		}
+
+		// best.2 is the second best, and so on
+		if i := strings.LastIndex(base, "."); i > 0 {
+			if _, err := strconv.Atoi(base[i+1:]); err == nil {
+				base = base[:i]
+			}
+		}
+
+		if base != "" && contains(formatSelectors, base) == false && contains(formatExtensions, base) == false && formatIDPattern.MatchString(base) == false {
+			return fmt.Errorf("unknown format selector %q in %q", base, selector)
+		}
+
+		for filters != "" {
+			end := strings.Index(filters, "]")
+			if filters[0] != '[' || end < 0 {
+				return fmt.Errorf("unbalanced [ ] in %q", selector)
+			}
+			if formatFilterPattern.MatchString(strings.TrimSpace(filters[1:end])) == false {
+				return fmt.Errorf("format filter %q in %q is not valid", filters[:end+1], selector)
+			}
+			filters = filters[end+1:]
+		}
+	}
+	return nil
+}
+
+// PrintValidation writes the report for the validate command and returns the
+// process exit code. Problems quote the settings they are about, so secrets
+// are redacted.
+func PrintValidation(w io.Writer, s settings, report ValidationReport) int {
+	for _, p := range report.Global {
+		fmt.Fprintln(w, "ERROR  "+Redact(p.String()))
+	}
+
+	for i, p := range s.PodcastDownload {
+		switch {
+		case p.Disabled:
+			fmt.Fprintln(w, "OFF    "+p.Name+" ("+p.ChannelID+")")
+		case len(report.Channels[i]) == 0:
+			fmt.Fprintln(w, "OK     "+p.Name+" ("+p.ChannelID+")")
+		}
+		for _, problem := range report.Channels[i] {
+			fmt.Fprintln(w, "ERROR  "+Redact(problem.String()))
+		}
+		PrintEffectiveChannel(w, s, p)
+	}
+
+	problems := len(report.Problems())
+	if problems > 0 {
+		fmt.Fprintf(w, "\n%d problem(s) found\n", problems)
+		return 1
+	}
+	fmt.Fprintf(w, "\nsettings are valid, %d channel(s)\n", len(s.PodcastDownload))
+	return 0
+}
+
+// PrintEffectiveChannel lists the settings a channel ends up with after
+// Defaults and the global settings are applied, and where each came from.
+// Secrets are redacted.
+func PrintEffectiveChannel(w io.Writer, s settings, p YouTubeDownload) {
+	effective, sources := ResolveChannel(s, p)
+	values := reflect.ValueOf(effective)
+	names := []string{"DownloadArchive"}
+	for _, f := range reflect.VisibleFields(reflect.TypeOf(ChannelDefaults{})) {
+		names = append(names, f.Name)
+	}
+	for _, name := range names {
+		value := values.FieldByName(name).String()
+		source := sources[name]
+		if value == "" {
+			value, source = "-", "unset"
+		}
+		if source == "" {
+			source = SourceChannel
+		}
+		fmt.Fprintf(w, "         %-18s %-40s %s\n", name, Redact(value), source)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestValidateSettingsNamesField(t *testing.T) {
+	s := settings{Config: t.TempDir() + "/", RetryBackoff: "-1s", VideoTimeout: "soon", MaxDownloads: "0", PUID: "root"}
+	s.Defaults.BackfillBatch = "none"
+	s.Defaults.MinDuration = "short"
+
+	want := map[string]string{
+		"RetryBackoff":           `"-1s" is not a duration such as 30s`,
+		"VideoTimeout":           `"soon" is not a duration such as 2h, or 0 for no limit`,
+		"MaxDownloads":           `"0" is not a number of 1 or more`,
+		"PUID":                   `"root" is not a numeric user or group ID`,
+		"Defaults.BackfillBatch": `"none" is not a number of videos of 1 or more`,
+		"Defaults.MinDuration":   `"short" is not a duration such as 90s or 2h`,
+	}
+	for _, p := range ValidateSettings(s).Global {
+		if message, ok := want[p.Field]; ok {
+			if p.Message != message {
+				t.Errorf("%s: message = %q, want %q", p.Field, p.Message, message)
+			}
+			delete(want, p.Field)
+		}
+	}
+	for field := range want {
+		t.Errorf("no problem reported for %s", field)
+	}
+}
+
+func TestPrintValidationRedactsSecrets(t *testing.T) {
+	s := settings{Config: t.TempDir() + "/"}
+	s.PodcastDownload = []YouTubeDownload{{Name: "Chan", Cookies: "/no/such/secret-cookies.txt"}}
+	RegisterSettingsSecrets(s)
+
+	var out bytes.Buffer
+	PrintValidation(&out, s, ValidateSettings(s))
+	if strings.Contains(out.String(), "secret-cookies") {
+		t.Errorf("validate output shows the cookies file:\n%s", out.String())
+	}
+	if strings.Contains(out.String(), "Cookies: cookies file \"[REDACTED]\" does not exist") == false {
+		t.Errorf("validate output does not report the cookies file:\n%s", out.String())
+	}
+}
+
+func TestValidateFormatSelector(t *testing.T) {
+	valid := []string{"best", "bestvideo[height<=1080]+bestaudio/best", "137+140", "251-drc", "hls-1080p/dash-2176", "mp4", "bv*[ext=mp4]+ba[ext=m4a]/b", "best.2", "sb0"}
+	for _, selector := range valid {
+		if err := ValidateFormatSelector(selector); err != nil {
+			t.Errorf("ValidateFormatSelector(%q) = %v, want nil", selector, err)
+		}
+	}
+
+	invalid := map[string]string{
+		"bestvidoe+bestaudoi/bset": `unknown format selector "bestvidoe"`,
+		"best/hd":                  `unknown format selector "hd"`,
+		"mp5":                      `unknown format selector "mp5"`,
+		"best[height<=":            "unbalanced",
+	}
+	for selector, want := range invalid {
+		if err := ValidateFormatSelector(selector); err == nil || strings.Contains(err.Error(), want) == false {
+			t.Errorf("ValidateFormatSelector(%q) = %v, want an error containing %q", selector, err, want)
+		}
+	}
+}
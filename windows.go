@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// BacklogAge is how long ago a video has to have been uploaded to count as
+// backlog, which only downloads within BacklogWindow. Videos whose upload
+// date is not known count as new.
+const BacklogAge = 7 * 24 * time.Hour
+
+// limitRatePattern is the yt-dlp --limit-rate syntax, bytes per second with
+// an optional K, M or G suffix.
+var limitRatePattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?[KMGkmg]?$`)
+
+// ParseWindows reads a DownloadWindow or BacklogWindow setting: comma
+// separated times of day such as "01:00-07:00,22:00-23:30" in the configured
+// TimeZone. Like QuietHours, a window whose end is before its start runs over
+// midnight. Empty means any time.
+func ParseWindows(setting string) ([]QuietHours, error) {
+	var windows []QuietHours
+	if strings.TrimSpace(setting) == "" {
+		return windows, nil
+	}
+
+	for _, part := range strings.Split(setting, ",") {
+		start, end, ok := strings.Cut(part, "-")
+		if ok == false {
+			return nil, fmt.Errorf("%q is not a window such as 01:00-07:00", strings.TrimSpace(part))
+		}
+		window := QuietHours{Start: strings.TrimSpace(start), End: strings.TrimSpace(end)}
+		if _, err := window.Contains(time.Now()); err != nil {
+			return nil, err
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+// InWindows reports whether t, already in the right location, falls inside
+// any of windows. No windows at all means any time.
+func InWindows(windows []QuietHours, t time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+	for _, w := range windows {
+		if in, _ := w.Contains(t); in {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBacklog reports whether a video uploaded at uploaded counts as backlog.
+func IsBacklog(uploaded time.Time, now time.Time) bool {
+	return uploaded.IsZero() == false && now.Sub(uploaded) > BacklogAge
+}
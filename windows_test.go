@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWindows(t *testing.T) {
+	windows, err := ParseWindows(" 01:00-07:00, 22:00 - 23:30 ")
+	if err != nil || len(windows) != 2 || windows[1] != (QuietHours{Start: "22:00", End: "23:30"}) {
+		t.Errorf("ParseWindows = %+v, %v, want two windows", windows, err)
+	}
+	if windows, err := ParseWindows(""); err != nil || len(windows) != 0 {
+		t.Errorf("ParseWindows of nothing = %+v, %v, want no windows", windows, err)
+	}
+	for _, setting := range []string{"01:00", "01:00-7pm", "01:00-07:00,", "25:00-26:00"} {
+		if _, err := ParseWindows(setting); err == nil {
+			t.Errorf("ParseWindows(%q) accepted it", setting)
+		}
+	}
+}
+
+func TestInWindows(t *testing.T) {
+	windows, err := ParseWindows("01:00-07:00,22:00-00:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"00:59": false,
+		"01:00": true,
+		"06:59": true,
+		"07:00": false,
+		"12:00": false,
+		"22:00": true,
+		"00:29": true,
+		"00:30": false,
+	}
+	for clock, want := range tests {
+		at, _ := time.Parse("15:04", clock)
+		if got := InWindows(windows, at); got != want {
+			t.Errorf("InWindows(%s) = %v, want %v", clock, got, want)
+		}
+	}
+	if InWindows(nil, time.Now()) == false {
+		t.Errorf("no windows should mean any time")
+	}
+}
+
+func TestIsBacklog(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		uploaded time.Time
+		want     bool
+	}{
+		{time.Time{}, false},
+		{now.Add(-24 * time.Hour), false},
+		{now.Add(-BacklogAge), false},
+		{now.Add(-BacklogAge - time.Hour), true},
+	}
+	for _, tt := range tests {
+		if got := IsBacklog(tt.uploaded, now); got != tt.want {
+			t.Errorf("IsBacklog(%s) = %v, want %v", tt.uploaded, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"strconv"
+)
+
+const DefaultChannelWorkers = 1
+
+// Limiter lets at most cap(l) callers in at once.
+type Limiter chan struct{}
+
+func NewLimiter(n int) Limiter {
+	return make(Limiter, n)
+}
+
+// Acquire waits for a free slot, giving up when ctx is done.
+func (l Limiter) Acquire(ctx context.Context) error {
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l Limiter) Release() {
+	<-l
+}
+
+// Workers is how much a run does at once: Channels are processed side by
+// side, with at most Downloads yt-dlp downloads running between them.
+type Workers struct {
+	Channels  int
+	Downloads int
+}
+
+// LoadWorkers reads ChannelWorkers, 1 by default, and MaxDownloads, which
+// defaults to ChannelWorkers.
+func LoadWorkers(s settings) (Workers, error) {
+	w := Workers{Channels: DefaultChannelWorkers}
+
+	counts := []struct {
+		field   string
+		setting string
+		value   *int
+	}{
+		{"ChannelWorkers", s.ChannelWorkers, &w.Channels},
+		{"MaxDownloads", s.MaxDownloads, &w.Downloads},
+	}
+	for _, c := range counts {
+		if c.setting == "" {
+			continue
+		}
+		n, err := strconv.Atoi(c.setting)
+		if err != nil || n < 1 {
+			return w, settingError(c.field, "%q is not a number of 1 or more", c.setting)
+		}
+		*c.value = n
+	}
+
+	if w.Downloads == 0 {
+		w.Downloads = w.Channels
+	}
+	return w, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateExtraArgs(t *testing.T) {
+	valid := []string{"", "--sleep-interval 5 --embed-chapters", "-v --no-part", "--cookies-from-browser firefox", "-N 4", "-Nf", "--sleep-requests=1"}
+	for _, extra := range valid {
+		if err := ValidateExtraArgs(extra); err != nil {
+			t.Errorf("ValidateExtraArgs(%q) = %v, want nil", extra, err)
+		}
+	}
+
+	invalid := map[string]string{
+		"-o /tmp/x":            "-o is set by the tool",
+		"-o/tmp/x":             "-o is set by the tool",
+		"-fbest":               "-f is set by the tool; use FileQuality",
+		"--remux mkv":          "--remux-video is set by the tool; use FileFormat",
+		"--extract-a":          "--extract-audio is set by the tool",
+		"--merge-output mkv":   "--merge-output-format is set by the tool",
+		"--match-f duration>1": "--match-filter is set by the tool",
+		"--playlist-i 1-100":   "--playlist-items is set by the tool",
+		"--remux=mkv":          "--remux-video is set by the tool",
+		"-vx":                  "-x is set by the tool",
+		"-vf worst":            "-f is set by the tool",
+		"-iqv":                 "-q is set by the tool",
+		"--":                   "would end yt-dlp's options",
+	}
+	for extra, want := range invalid {
+		if err := ValidateExtraArgs(extra); err == nil || strings.Contains(err.Error(), want) == false {
+			t.Errorf("ValidateExtraArgs(%q) = %v, want an error containing %q", extra, err, want)
+		}
+	}
+}